@@ -34,9 +34,10 @@ import (
 	"github.com/liangdas/mqant/module/modules"
 	"github.com/liangdas/mqant/registry"
 	mqrpc "github.com/liangdas/mqant/rpc"
+	argsutil "github.com/liangdas/mqant/rpc/util"
 	"github.com/liangdas/mqant/selector"
 	"github.com/liangdas/mqant/selector/cache"
-	"github.com/nats-io/nats.go"
+	"github.com/liangdas/mqant/transport"
 	"github.com/pkg/errors"
 )
 
@@ -64,6 +65,7 @@ func newOptions(opts ...module.Option) module.Options {
 		KillWaitTTL:      time.Second * time.Duration(60),
 		RPCExpired:       time.Second * time.Duration(10),
 		RPCMaxCoroutine:  0, //不限制
+		LocalRPC:         true,
 		Debug:            true,
 		// 使用默认的配置
 		AppConf: conf.NewOptions(),
@@ -103,6 +105,7 @@ type DefaultApp struct {
 	startup             func(app module.App)
 	moduleInited        func(app module.App, module module.Module)
 	protocolMarshal     func(Trace string, Result interface{}, Error string) (module.ProtocolMarshal, string)
+	natsConn            *transport.NatsConn //根据配置创建的nats连接
 }
 
 // Run 运行应用
@@ -121,7 +124,10 @@ func (app *DefaultApp) Run(mods ...module.Module) error {
 		mods[i].OnAppConfigurationLoaded(app)
 		manager.Register(mods[i])
 	}
-	app.OnInit(app.settings)
+	if err := app.OnInit(app.settings); err != nil {
+		log.Error("mqant init error %v", err)
+		return err
+	}
 	manager.Init(app, app.opts.ProcessID)
 	if app.startup != nil {
 		app.startup(app)
@@ -177,9 +183,9 @@ func (app *DefaultApp) Options() module.Options {
 	return app.opts
 }
 
-// Transport Transport
-func (app *DefaultApp) Transport() *nats.Conn {
-	return app.opts.Nats
+// Transport RPC消息通道
+func (app *DefaultApp) Transport() transport.Transport {
+	return app.opts.Transport
 }
 
 // Registry Registry
@@ -209,17 +215,33 @@ func (app *DefaultApp) Configure(settings conf.Config) error {
 }
 
 // OnInit 初始化
+// 没有通过module.Nats或者module.Transport传入消息通道时,使用配置文件中的Nats配置创建连接
 func (app *DefaultApp) OnInit(settings conf.Config) error {
-
+	if app.opts.Transport == nil && len(settings.Nats.Servers) > 0 {
+		nc, err := transport.DialNats(settings.Nats)
+		if err != nil {
+			return err
+		}
+		app.natsConn = nc
+		app.opts.Nats = nc.Conn()
+		app.opts.Transport = nc.Transport()
+	}
 	return nil
 }
 
 // OnDestroy 应用退出
 func (app *DefaultApp) OnDestroy() error {
-
+	if app.natsConn != nil {
+		app.natsConn.Close()
+	}
 	return nil
 }
 
+// NatsConn 根据配置创建的nats连接,可以查询连接状态
+func (app *DefaultApp) NatsConn() *transport.NatsConn {
+	return app.natsConn
+}
+
 // GetServerByID 通过服务ID获取服务实例
 func (app *DefaultApp) GetServerByID(serverID string) (module.ServerSession, error) {
 	session, ok := app.serverList.Load(serverID)
@@ -259,6 +281,10 @@ func (app *DefaultApp) GetServerBySelector(serviceName string, opts ...selector.
 	if err != nil {
 		return nil, err
 	}
+	return app.getServerSession(serviceName, node)
+}
+
+func (app *DefaultApp) getServerSession(serviceName string, node *registry.Node) (module.ServerSession, error) {
 	session, ok := app.serverList.Load(node.Id)
 	if !ok {
 		s, err := basemodule.NewServerSession(app, serviceName, node)
@@ -270,17 +296,23 @@ func (app *DefaultApp) GetServerBySelector(serviceName string, opts ...selector.
 	}
 	session.(module.ServerSession).SetNode(node)
 	return session.(module.ServerSession), nil
-
 }
 
 // GetServersByType 通过服务类型获取服务实例列表
 func (app *DefaultApp) GetServersByType(serviceName string) []module.ServerSession {
+	return app.getServersByType(serviceName)
+}
+
+func (app *DefaultApp) getServersByType(serviceName string, filters ...selector.Filter) []module.ServerSession {
 	sessions := make([]module.ServerSession, 0)
 	services, err := app.opts.Selector.GetService(serviceName)
 	if err != nil {
 
 		return sessions
 	}
+	for _, filter := range filters {
+		services = filter(services)
+	}
 	for _, service := range services {
 		//log.TInfo(nil,"GetServersByType3 %v %v",Type,service.Nodes)
 		for _, node := range service.Nodes {
@@ -301,20 +333,32 @@ func (app *DefaultApp) GetServersByType(serviceName string) []module.ServerSessi
 	return sessions
 }
 
+// GetQueueServer 通过队列组调用moduleType的任意一个节点
+func (app *DefaultApp) GetQueueServer(moduleType string) (module.ServerSession, error) {
+	subject := transport.ModuleSubject(moduleType)
+	if session, ok := app.serverList.Load(subject); ok {
+		return session.(module.ServerSession), nil
+	}
+	s, err := basemodule.NewServerSession(app, moduleType, &registry.Node{
+		Id:      subject,
+		Address: subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session, loaded := app.serverList.LoadOrStore(subject, s); loaded {
+		s.GetRPC().Done()
+		return session.(module.ServerSession), nil
+	}
+	return s, nil
+}
+
 // GetRouteServer 通过选择器过滤服务实例
 func (app *DefaultApp) GetRouteServer(filter string, opts ...selector.SelectOption) (s module.ServerSession, err error) {
-	if app.mapRoute != nil {
-		//进行一次路由转换
-		filter = app.mapRoute(app, filter)
-	}
-	sl := strings.Split(filter, "@")
-	if len(sl) == 2 {
-		moduleID := sl[1]
-		if moduleID != "" {
-			return app.GetServerById(filter)
-		}
+	filter, moduleType, byID := app.parseRoute(filter)
+	if byID {
+		return app.GetServerByID(filter)
 	}
-	moduleType := sl[0]
 	return app.GetServerBySelector(moduleType, opts...)
 }
 
@@ -366,12 +410,87 @@ func (app *DefaultApp) RpcInvokeNR(module module.RPCModule, moduleType string, _
 
 // Call Call
 func (app *DefaultApp) Call(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (result interface{}, errstr string) {
-	server, err := app.GetRouteServer(moduleType, opts...)
+	result, err := app.CallE(ctx, moduleType, _func, param, opts...)
 	if err != nil {
 		errstr = err.Error()
-		return
 	}
-	return server.Call(ctx, _func, param()...)
+	return
+}
+
+// CallAsync 异步调用,立即返回Future,参数在返回前已经求值
+func (app *DefaultApp) CallAsync(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) *mqrpc.Future {
+	future := mqrpc.NewFuture()
+	//在返回前完成编码,调用方之后修改参数不影响本次调用
+	params := param()
+	ArgsType := make([]string, len(params))
+	args := make([][]byte, len(params))
+	for k, v := range params {
+		var err error
+		ArgsType[k], args[k], err = argsutil.ArgsTypeAnd2Bytes(app, v)
+		if err != nil {
+			future.Complete(nil, mqrpc.NewError(mqrpc.CodeInvalidArgument, "args[%d] error %s", k, err.Error()))
+			return future
+		}
+	}
+	go func() {
+		future.Complete(app.call(ctx, moduleType, _func, func(ctx context.Context, server module.ServerSession) (interface{}, error) {
+			return server.CallArgsE(ctx, _func, ArgsType, args)
+		}, opts...))
+	}()
+	return future
+}
+
+// CallInto 调用成功后将结果解码到out中,out必须是指针
+func (app *DefaultApp) CallInto(ctx context.Context, moduleType, _func string, out interface{}, param mqrpc.ParamOption, opts ...selector.SelectOption) error {
+	result, err := app.CallE(ctx, moduleType, _func, param, opts...)
+	if err != nil {
+		return err
+	}
+	if e := mqrpc.Assign(out, result); e != nil {
+		return mqrpc.WrapError(mqrpc.CodeInternal, e)
+	}
+	return nil
+}
+
+// CallE 与Call相同,错误以*mqrpc.Error返回
+func (app *DefaultApp) CallE(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (result interface{}, err error) {
+	params := param()
+	return app.call(ctx, moduleType, _func, func(ctx context.Context, server module.ServerSession) (interface{}, error) {
+		return server.CallE(ctx, _func, params...)
+	}, opts...)
+}
+
+// call 选择节点并通过invoke发起调用,按RetryPolicy重试
+func (app *DefaultApp) call(ctx context.Context, moduleType, _func string, invoke func(ctx context.Context, server module.ServerSession) (interface{}, error), opts ...selector.SelectOption) (result interface{}, err error) {
+	serviceName, next, e := app.route(moduleType, opts...)
+	if e != nil {
+		ce := mqrpc.NewError(mqrpc.CodeUnavailable, "%s", e.Error())
+		ce.Retryable = true
+		return nil, ce
+	}
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	policy := app.opts.RetryPolicy
+	for attempt := 1; ; attempt++ {
+		server, e := next()
+		if e != nil {
+			ce := mqrpc.NewError(mqrpc.CodeUnavailable, "%s", e.Error())
+			ce.Retryable = true
+			err = ce
+		} else {
+			result, err = invoke(ctx, server)
+			app.mark(serviceName, server.GetNode(), err)
+		}
+		if !policy.ShouldRetry(attempt, serviceName, _func, err) {
+			return result, err
+		}
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(policy.BackoffFor(attempt)):
+		}
+	}
 }
 
 // RpcCall RpcCall
@@ -0,0 +1,100 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/selector"
+)
+
+// CallAll 并行调用moduleType类型的所有节点(或者经过筛选的节点),正在下线的节点不会被调用
+// 所有调用共用ctx的超时时间,ctx没有设置超时时间时使用Options.RPCExpired
+// 返回每个节点的结果,顺序与节点顺序一致;成功数达不到Quorum或者First时返回错误
+// 设置了First时拿到足够的结果后立即返回,其余节点的结果为CodeCanceled,调用在后台被取消
+func (app *DefaultApp) CallAll(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...module.CallAllOption) ([]module.NodeResult, error) {
+	o := module.CallAllOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	//正在下线的节点总是先被排除,再应用调用方的筛选
+	filters := append([]selector.Filter{selector.FilterDraining}, o.Filters...)
+	sessions := app.getServersByType(moduleType, filters...)
+	if len(sessions) == 0 {
+		e := mqrpc.NewError(mqrpc.CodeUnavailable, "no servers of type %s", moduleType)
+		e.Retryable = true
+		return nil, e
+	}
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.opts.RPCExpired)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type nodeDone struct {
+		index  int
+		result interface{}
+		err    error
+	}
+	params := param()
+	results := make([]module.NodeResult, len(sessions))
+	done := make(chan nodeDone, len(sessions))
+	for i, session := range sessions {
+		results[i].NodeID = session.GetID()
+		go func(i int, session module.ServerSession) {
+			r, err := session.CallE(ctx, _func, params...)
+			done <- nodeDone{index: i, result: r, err: err}
+		}(i, session)
+	}
+
+	target := o.First
+	if o.Quorum > target {
+		target = o.Quorum
+	}
+	succeeded := 0
+	finished := make([]bool, len(sessions))
+	for pending := len(sessions); pending > 0; pending-- {
+		d := <-done
+		finished[d.index] = true
+		results[d.index].Result = d.result
+		results[d.index].Err = d.err
+		if d.err == nil {
+			succeeded++
+		}
+		if o.First > 0 && succeeded >= o.First {
+			//已经拿到足够的结果,立即返回,其余的调用被取消后在后台结束
+			for i := range results {
+				if !finished[i] {
+					results[i].Err = mqrpc.NewError(mqrpc.CodeCanceled, "canceled after the first %d results", o.First)
+				}
+			}
+			break
+		} else if target > 0 && succeeded+pending-1 < target {
+			//剩余的节点全部成功也达不到要求了
+			cancel()
+		}
+	}
+	if target > 0 && succeeded < target {
+		return results, mqrpc.NewError(mqrpc.CodeUnavailable, "%s.%s quorum not reached %d/%d", moduleType, _func, succeeded, target)
+	}
+	return results, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"strings"
+
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/selector"
+)
+
+// 重试时从Next中最多取几次节点来避开已经调用过的节点
+const maxRetryPick = 3
+
+/**
+解析路由 moduleType|moduleType@moduleID,设置了SetMapRoute时先进行一次路由转换
+返回转换后的路由、服务名,以及是否指定了节点ID
+*/
+func (app *DefaultApp) parseRoute(filter string) (string, string, bool) {
+	if app.mapRoute != nil {
+		//进行一次路由转换
+		filter = app.mapRoute(app, filter)
+	}
+	sl := strings.Split(filter, "@")
+	return filter, sl[0], len(sl) == 2 && sl[1] != ""
+}
+
+/**
+解析路由,返回服务名以及获取节点的函数
+指定了节点ID时每次都返回该节点,否则通过选择器的Next获取,并尽量避开已经返回过的节点
+*/
+func (app *DefaultApp) route(filter string, opts ...selector.SelectOption) (string, func() (module.ServerSession, error), error) {
+	filter, serviceName, byID := app.parseRoute(filter)
+	if byID {
+		return serviceName, func() (module.ServerSession, error) {
+			return app.GetServerByID(filter)
+		}, nil
+	}
+	next, err := app.opts.Selector.Select(serviceName, opts...)
+	if err != nil {
+		return serviceName, nil, err
+	}
+	tried := map[string]bool{}
+	return serviceName, func() (module.ServerSession, error) {
+		var node *registry.Node
+		for i := 0; i < maxRetryPick; i++ {
+			n, err := next()
+			if err != nil {
+				return nil, err
+			}
+			node = n
+			if !tried[n.Id] {
+				break
+			}
+		}
+		tried[node.Id] = true
+		return app.getServerSession(serviceName, node)
+	}, nil
+}
+
+/**
+把调用结果反馈给选择器
+只有节点不可用或者超时才算节点的错误,业务错误说明节点是正常的,调用方主动取消的不反馈
+修改这里的分类时同步修改 selector/cache 中FailureThreshold的说明
+*/
+func (app *DefaultApp) mark(serviceName string, node *registry.Node, err error) {
+	if node == nil {
+		return
+	}
+	switch mqrpc.ErrorCode(err) {
+	case mqrpc.CodeUnavailable, mqrpc.CodeDeadlineExceeded:
+		app.opts.Selector.Mark(serviceName, node, err)
+	case mqrpc.CodeCanceled:
+	default:
+		app.opts.Selector.Mark(serviceName, node, nil)
+	}
+}
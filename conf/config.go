@@ -50,6 +50,7 @@ type Config struct {
 	BI       map[string]interface{}
 	OP       map[string]interface{}
 	RPC      RPC `json:"rpc"`
+	Nats     Nats
 	Module   map[string][]*ModuleSettings
 	Mqtt     Mqtt
 	Settings map[string]interface{}
@@ -62,6 +63,30 @@ type RPC struct {
 	Log          bool //是否打印RPC的日志
 }
 
+// Nats nats连接配置,配置了Servers且应用没有传入消息通道时由app创建连接
+type Nats struct {
+	Servers        []string //服务器地址列表,例如 nats://127.0.0.1:4222
+	Name           string   //连接名称,在nats监控中显示
+	User           string
+	Password       string
+	Token          string
+	Credentials    string //.creds凭证文件路径
+	TLS            NatsTLS
+	MaxReconnects  int //断开后最多重连的次数,0使用nats默认值,小于0无限重连;超过后由app重新建立连接
+	ReconnectWait  int //重连间隔 单位毫秒,0使用nats默认值
+	PingInterval   int //心跳间隔 单位毫秒,0使用nats默认值
+	MaxPingsOut    int //未收到应答的心跳达到该数量时认为连接断开,0使用nats默认值
+	ConnectTimeout int //建立连接的超时 单位毫秒,0使用nats默认值
+}
+
+// NatsTLS nats的TLS配置,CA、Cert不为空或者InsecureSkipVerify为true时启用TLS
+type NatsTLS struct {
+	CA                 string //CA证书路径
+	Cert               string //客户端证书路径
+	Key                string //客户端私钥路径
+	InsecureSkipVerify bool   //不校验服务器证书,只用于测试环境
+}
+
 // ModuleSettings 模块配置
 type ModuleSettings struct {
 	ID        string `json:"ID"`
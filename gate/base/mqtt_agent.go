@@ -26,6 +26,7 @@ import (
 	"github.com/liangdas/mqant/module"
 	"github.com/liangdas/mqant/network"
 	"github.com/liangdas/mqant/rpc/util"
+	"github.com/liangdas/mqant/tracing"
 	"github.com/liangdas/mqant/utils"
 	"runtime"
 	"strings"
@@ -55,6 +56,8 @@ type agent struct {
 	revNum                       int64
 	sendNum                      int64
 	connTime                     time.Time
+	ctx                          context.Context //连接断开时取消,用于取消转发中的RPC调用
+	cancel                       context.CancelFunc
 }
 
 func NewMqttAgent(module module.RPCModule) *agent {
@@ -65,6 +68,7 @@ func NewMqttAgent(module module.RPCModule) *agent {
 }
 func (age *agent) OnInit(gate gate.Gate, conn network.Conn) error {
 	age.ch = make(chan int, gate.Options().ConcurrentTasks)
+	age.ctx, age.cancel = context.WithCancel(context.Background())
 	age.conn = conn
 	age.gate = gate
 	age.r = bufio.NewReaderSize(conn, gate.Options().BufSize)
@@ -192,6 +196,10 @@ func (age *agent) OnClose() error {
 		}
 	}()
 	age.isclose = true
+	if age.cancel != nil {
+		//玩家已经断开,取消还在等待应答的RPC调用,服务端的handler也会收到取消
+		age.cancel()
+	}
 	age.gate.GetAgentLearner().DisConnect(age) //发送连接断开的事件
 	return nil
 }
@@ -265,8 +273,18 @@ func (age *agent) recoverworker(pack *mqtt.Pack) {
 		age.revNum = age.revNum + 1
 		age.lock.Unlock()
 		pub := pack.GetVariable().(*mqtt.Publish)
+		//网关消息的span,转发的RPC调用成为它的子span
+		ctx := age.ctx
+		if ctx == nil {
+			ctx = context.TODO()
+		}
+		ctx, span := age.module.GetApp().Options().Tracer.Start(ctx, "gate "+*pub.GetTopic(), tracing.SpanKindServer)
+		span.SetAttribute("gate.topic", *pub.GetTopic())
+		span.SetAttribute("gate.session", age.GetSession().GetSessionID())
+		defer span.End()
 		if age.gate.GetRouteHandler() != nil {
 			needreturn, result, err := age.gate.GetRouteHandler().OnRoute(age.GetSession(), *pub.GetTopic(), pub.GetMsg())
+			span.SetError(err)
 			if err != nil {
 				if needreturn {
 					toResult(age, *pub.GetTopic(), result, err.Error())
@@ -328,8 +346,11 @@ func (age *agent) recoverworker(pack *mqtt.Pack) {
 					return
 				}
 				args[0] = b
-				ctx, _ := context.WithTimeout(context.TODO(), age.module.GetApp().Options().RPCExpired)
+				ctx, _ := context.WithTimeout(ctx, age.module.GetApp().Options().RPCExpired)
 				result, e := serverSession.CallArgs(ctx, topics[1], ArgsType, args)
+				if e != "" {
+					span.SetError(errors.New(e))
+				}
 				toResult(age, *pub.GetTopic(), result, e)
 			} else {
 				ArgsType[0] = RPCParamSessionType
@@ -340,6 +361,7 @@ func (age *agent) recoverworker(pack *mqtt.Pack) {
 				args[0] = b
 
 				e := serverSession.CallNRArgs(topics[1], ArgsType, args)
+				span.SetError(e)
 				if e != nil {
 					log.Warning("Gate rpc", e.Error())
 				}
@@ -38,10 +38,10 @@ func (a *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rsp := &go_api.Response{}
 	ctx, _ := context.WithTimeout(context.TODO(), a.Opts.TimeOut)
 	if err = mqrpc.Proto(rsp, func() (reply interface{}, errstr interface{}) {
-		return server.SrvSession.Call(ctx, server.Hander, request)
+		return server.SrvSession.CallE(ctx, server.Hander, request)
 	}); err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		ce := errors.Parse(err.Error())
+		ce := errors.FromRPC("httpgateway", err)
 		switch ce.Code {
 		case 0:
 			w.WriteHeader(500)
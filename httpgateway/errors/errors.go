@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/liangdas/mqant/rpc"
 )
 
 // Error implements the error interface.
@@ -121,3 +123,39 @@ func InternalServerError(id, format string, a ...interface{}) error {
 		Status: http.StatusText(500),
 	}
 }
+
+// FromRPC converts an rpc call error into an http error. Business errors
+// returned by the handler are parsed as JSON so handlers can keep returning
+// errors created by this package.
+func FromRPC(id string, err error) *Error {
+	e, ok := err.(*mqrpc.Error)
+	if !ok || e.Code == mqrpc.CodeBusiness || e.Code == mqrpc.CodeUnknown {
+		return Parse(err.Error())
+	}
+	code := StatusCode(e.Code)
+	return &Error{
+		Id:     id,
+		Code:   code,
+		Detail: e.Message,
+		Status: http.StatusText(int(code)),
+	}
+}
+
+// StatusCode maps an rpc error code to an http status code.
+func StatusCode(code int32) int32 {
+	switch code {
+	case mqrpc.CodeOK:
+		return http.StatusOK
+	case mqrpc.CodeInvalidArgument:
+		return http.StatusBadRequest
+	case mqrpc.CodeNotFound:
+		return http.StatusNotFound
+	case mqrpc.CodeDeadlineExceeded:
+		return http.StatusRequestTimeout
+	case mqrpc.CodeUnavailable, mqrpc.CodeOverloaded:
+		return http.StatusServiceUnavailable
+	case mqrpc.CodeRejected:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
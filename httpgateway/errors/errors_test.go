@@ -3,6 +3,8 @@ package errors
 import (
 	"net/http"
 	"testing"
+
+	"github.com/liangdas/mqant/rpc"
 )
 
 func TestErrors(t *testing.T) {
@@ -45,3 +47,15 @@ func TestErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestFromRPC(t *testing.T) {
+	e := FromRPC("test", mqrpc.NewError(mqrpc.CodeNotFound, "not found"))
+	if e.Code != 404 || e.Detail != "not found" {
+		t.Fatalf("Expected 404 not found, got %v", e)
+	}
+	// business errors are still parsed as JSON
+	e = FromRPC("test", mqrpc.NewError(mqrpc.CodeBusiness, "%s", BadRequest("test", "bad").Error()))
+	if e.Code != 400 || e.Detail != "bad" {
+		t.Fatalf("Expected 400 bad, got %v", e)
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics 内置的指标统计,以Prometheus文本格式输出,不依赖外部的采集库
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets 默认的耗时分布区间,单位秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry 指标的集合
+type Registry struct {
+	lock    sync.RWMutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry 创建一个空的Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: map[string]metric{},
+	}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric %s", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteText 以Prometheus文本格式输出所有指标,按名称排序
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.lock.RUnlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler 输出指标的http.Handler,可以直接挂载到 /metrics 供Prometheus抓取
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+/**
+同一个指标按照标签值区分的子项
+*/
+type vec struct {
+	name     string
+	help     string
+	typ      string
+	labels   []string
+	lock     sync.RWMutex
+	children map[string]interface{}
+	values   map[string][]string
+	create   func() interface{}
+}
+
+func newVec(name, help, typ string, labels []string, create func() interface{}) *vec {
+	return &vec{
+		name:     name,
+		help:     help,
+		typ:      typ,
+		labels:   labels,
+		children: map[string]interface{}{},
+		values:   map[string][]string{},
+		create:   create,
+	}
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.lock.RLock()
+	child, ok := v.children[key]
+	v.lock.RUnlock()
+	if ok {
+		return child
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.create()
+	v.children[key] = child
+	v.values[key] = append([]string(nil), values...)
+	return child
+}
+
+/**
+按照标签值排序遍历子项
+*/
+func (v *vec) each(f func(values []string, child interface{})) {
+	v.lock.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]interface{}, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+		values[i] = v.values[key]
+	}
+	v.lock.RUnlock()
+	for i := range keys {
+		f(values[i], children[i])
+	}
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+func (v *vec) writeSample(w *bufio.Writer, suffix string, values []string, extra string, value float64) {
+	w.WriteString(v.name)
+	w.WriteString(suffix)
+	if len(values) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, label := range v.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		if extra != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extra)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+/**
+float64的原子操作
+*/
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter 只增不减的计数
+type Counter struct {
+	value atomicFloat
+}
+
+// Inc 加1
+func (c *Counter) Inc() {
+	c.value.add(1)
+}
+
+// Add 增加v,v不能为负数
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.value.add(v)
+}
+
+// Value 当前值
+func (c *Counter) Value() float64 {
+	return c.value.load()
+}
+
+// CounterVec 按照标签区分的Counter
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec 在r中注册一个Counter
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels, func() interface{} { return new(Counter) })}
+	r.register(name, c)
+	return c
+}
+
+// WithLabelValues 标签值对应的Counter,顺序与注册时的标签一致
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	return c.with(values).(*Counter)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.each(func(values []string, child interface{}) {
+		c.writeSample(w, "", values, "", child.(*Counter).Value())
+	})
+}
+
+// Gauge 可增可减的数值,例如正在执行的请求数
+type Gauge struct {
+	value atomicFloat
+}
+
+// Inc 加1
+func (g *Gauge) Inc() {
+	g.value.add(1)
+}
+
+// Dec 减1
+func (g *Gauge) Dec() {
+	g.value.add(-1)
+}
+
+// Add 增加v
+func (g *Gauge) Add(v float64) {
+	g.value.add(v)
+}
+
+// Set 设置为v
+func (g *Gauge) Set(v float64) {
+	g.value.set(v)
+}
+
+// Value 当前值
+func (g *Gauge) Value() float64 {
+	return g.value.load()
+}
+
+// GaugeVec 按照标签区分的Gauge
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec 在r中注册一个Gauge
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels, func() interface{} { return new(Gauge) })}
+	r.register(name, g)
+	return g
+}
+
+// WithLabelValues 标签值对应的Gauge,顺序与注册时的标签一致
+func (g *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return g.with(values).(*Gauge)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.each(func(values []string, child interface{}) {
+		g.writeSample(w, "", values, "", child.(*Gauge).Value())
+	})
+}
+
+// Histogram 数值的分布,例如调用耗时
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     atomicFloat
+}
+
+// Observe 记录一个值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	h.sum.add(v)
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Count 记录的总次数
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum 记录的值的总和
+func (h *Histogram) Sum() float64 {
+	return h.sum.load()
+}
+
+// HistogramVec 按照标签区分的Histogram
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// NewHistogramVec 在r中注册一个Histogram,buckets为空时使用DefBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{buckets: buckets}
+	h.vec = newVec(name, help, "histogram", labels, func() interface{} {
+		return &Histogram{
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+	})
+	r.register(name, h)
+	return h
+}
+
+// WithLabelValues 标签值对应的Histogram,顺序与注册时的标签一致
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return h.with(values).(*Histogram)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.each(func(values []string, child interface{}) {
+		hist := child.(*Histogram)
+		//先读总数,并发记录时各区间之和不会超过总数
+		count := hist.Count()
+		sum := hist.Sum()
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += atomic.LoadUint64(&hist.counts[i])
+			if cumulative > count {
+				cumulative = count
+			}
+			h.writeSample(w, "_bucket", values, fmt.Sprintf("le=\"%s\"", formatFloat(bound)), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", values, "le=\"+Inf\"", float64(count))
+		h.writeSample(w, "_sum", values, "", sum)
+		h.writeSample(w, "_count", values, "", float64(count))
+	})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	labelEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	calls := r.NewCounterVec("test_calls_total", "Total calls.", "func")
+	calls.WithLabelValues("login").Inc()
+	calls.WithLabelValues("login").Add(2)
+	calls.WithLabelValues("say \"hi\"").Inc()
+	gauge := r.NewGaugeVec("test_in_flight", "In flight\ncalls.", "func")
+	gauge.WithLabelValues("login").Inc()
+	gauge.WithLabelValues("login").Inc()
+	gauge.WithLabelValues("login").Dec()
+	hist := r.NewHistogramVec("test_duration_seconds", "Latency.", []float64{0.1, 1}, "func")
+	hist.WithLabelValues("login").Observe(0.05)
+	hist.WithLabelValues("login").Observe(0.1)
+	hist.WithLabelValues("login").Observe(5)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("Unexpected error writing metrics: %v", err)
+	}
+	expected := `# HELP test_calls_total Total calls.
+# TYPE test_calls_total counter
+test_calls_total{func="login"} 3
+test_calls_total{func="say \"hi\""} 1
+# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{func="login",le="0.1"} 2
+test_duration_seconds_bucket{func="login",le="1"} 2
+test_duration_seconds_bucket{func="login",le="+Inf"} 3
+test_duration_seconds_sum{func="login"} 5.15
+test_duration_seconds_count{func="login"} 3
+# HELP test_in_flight In flight\ncalls.
+# TYPE test_in_flight gauge
+test_in_flight{func="login"} 1
+`
+	if buf.String() != expected {
+		t.Fatalf("Unexpected output:\n%s", buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Registering a duplicate metric should panic")
+		}
+	}()
+	r.NewCounterVec("test_calls_total", "Total calls.", "func")
+}
+
+func TestRPCMetricsHandler(t *testing.T) {
+	m := NewRPCMetrics(nil)
+	done := m.ClientBegin("game", "game@1", "login")
+	done(4)
+	finish := m.ServerBegin("game", "game@1", "login")
+	finish()
+	m.ServerDone("game", "game@1", "login", 0, 20*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Unexpected content type %s", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		`mqant_rpc_client_calls_total{module="game",node="game@1",func="login"} 1`,
+		`mqant_rpc_client_errors_total{module="game",node="game@1",func="login",code="4"} 1`,
+		`mqant_rpc_client_in_flight{module="game",node="game@1",func="login"} 0`,
+		`mqant_rpc_server_calls_total{module="game",node="game@1",func="login"} 1`,
+		`mqant_rpc_server_duration_seconds_bucket{module="game",node="game@1",func="login",le="0.025"} 1`,
+		`mqant_rpc_server_in_flight{module="game",node="game@1",func="login"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("Expected %s in:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "mqant_rpc_server_errors_total{") {
+		t.Fatalf("Successful calls should not be counted as errors:\n%s", body)
+	}
+}
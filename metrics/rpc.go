@@ -0,0 +1,96 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RPCMetrics RPC调用方与服务方的指标
+// 标签 module 为被调用的模块类型, node 为被调用的节点ID, func 为函数名, code 为错误码
+type RPCMetrics struct {
+	registry       *Registry
+	clientCalls    *CounterVec
+	clientErrors   *CounterVec
+	clientDuration *HistogramVec
+	clientInFlight *GaugeVec
+	serverCalls    *CounterVec
+	serverErrors   *CounterVec
+	serverDuration *HistogramVec
+	serverInFlight *GaugeVec
+}
+
+// NewRPCMetrics 在r中注册RPC指标,r为nil时创建新的Registry
+func NewRPCMetrics(r *Registry) *RPCMetrics {
+	if r == nil {
+		r = NewRegistry()
+	}
+	labels := []string{"module", "node", "func"}
+	errorLabels := []string{"module", "node", "func", "code"}
+	return &RPCMetrics{
+		registry:       r,
+		clientCalls:    r.NewCounterVec("mqant_rpc_client_calls_total", "Total number of RPC calls sent.", labels...),
+		clientErrors:   r.NewCounterVec("mqant_rpc_client_errors_total", "Total number of RPC calls that returned an error.", errorLabels...),
+		clientDuration: r.NewHistogramVec("mqant_rpc_client_duration_seconds", "Latency of RPC calls seen by the caller.", nil, labels...),
+		clientInFlight: r.NewGaugeVec("mqant_rpc_client_in_flight", "Number of RPC calls waiting for a reply.", labels...),
+		serverCalls:    r.NewCounterVec("mqant_rpc_server_calls_total", "Total number of RPC requests handled.", labels...),
+		serverErrors:   r.NewCounterVec("mqant_rpc_server_errors_total", "Total number of RPC requests that returned an error.", errorLabels...),
+		serverDuration: r.NewHistogramVec("mqant_rpc_server_duration_seconds", "Latency of RPC handlers.", nil, labels...),
+		serverInFlight: r.NewGaugeVec("mqant_rpc_server_in_flight", "Number of RPC handlers executing.", labels...),
+	}
+}
+
+// Registry 指标所在的Registry
+func (m *RPCMetrics) Registry() *Registry {
+	return m.registry
+}
+
+// Handler 以Prometheus文本格式输出指标
+func (m *RPCMetrics) Handler() http.Handler {
+	return m.registry.Handler()
+}
+
+// ClientBegin 调用方发出请求时调用,返回的函数在收到应答后调用,code为0表示成功
+func (m *RPCMetrics) ClientBegin(moduleType, node, fn string) func(code int32) {
+	inFlight := m.clientInFlight.WithLabelValues(moduleType, node, fn)
+	inFlight.Inc()
+	start := time.Now()
+	return func(code int32) {
+		inFlight.Dec()
+		m.clientCalls.WithLabelValues(moduleType, node, fn).Inc()
+		m.clientDuration.WithLabelValues(moduleType, node, fn).Observe(time.Since(start).Seconds())
+		if code != 0 {
+			m.clientErrors.WithLabelValues(moduleType, node, fn, strconv.Itoa(int(code))).Inc()
+		}
+	}
+}
+
+// ServerBegin 服务方开始执行handler时调用,返回的函数在handler结束后调用
+func (m *RPCMetrics) ServerBegin(moduleType, node, fn string) func() {
+	inFlight := m.serverInFlight.WithLabelValues(moduleType, node, fn)
+	inFlight.Inc()
+	return inFlight.Dec
+}
+
+// ServerDone 服务方发出应答时调用,包括没有执行handler就返回的错误
+func (m *RPCMetrics) ServerDone(moduleType, node, fn string, code int32, elapsed time.Duration) {
+	m.serverCalls.WithLabelValues(moduleType, node, fn).Inc()
+	m.serverDuration.WithLabelValues(moduleType, node, fn).Observe(elapsed.Seconds())
+	if code != 0 {
+		m.serverErrors.WithLabelValues(moduleType, node, fn, strconv.Itoa(int(code))).Inc()
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/liangdas/mqant/conf"
 	"github.com/liangdas/mqant/log"
 	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/server"
 )
 
 // NewModuleManager 新建模块管理器
@@ -115,7 +116,15 @@ func (mer *ModuleManager) CheckModuleSettings() {
 }
 
 // Destroy 停止模块
+// 先把所有模块标记为draining,各模块的宽限期同时开始计算,总共只等待一次
 func (mer *ModuleManager) Destroy() {
+	for _, m := range mer.runMods {
+		if s, ok := m.mi.(interface{ GetServer() server.Server }); ok && s.GetServer() != nil {
+			if err := s.GetServer().MarkDraining(); err != nil {
+				log.Warning("mark draining fail id(%s) error(%s)", s.GetServer().ID(), err)
+			}
+		}
+	}
 	for i := len(mer.runMods) - 1; i >= 0; i-- {
 		m := mer.runMods[i]
 		m.closeSig <- true
@@ -104,3 +104,34 @@ func (c *serverSession) CallArgs(ctx context.Context, _func string, ArgsType []s
 func (c *serverSession) CallNRArgs(_func string, ArgsType []string, args [][]byte) (err error) {
 	return c.rpc.CallNRArgs(_func, ArgsType, args)
 }
+
+/**
+消息请求 需要回复,错误以*mqrpc.Error返回
+*/
+func (c *serverSession) CallE(ctx context.Context, _func string, params ...interface{}) (interface{}, error) {
+	return c.rpc.CallE(ctx, _func, params...)
+}
+
+// CallAsync 异步调用,立即返回Future
+func (c *serverSession) CallAsync(ctx context.Context, _func string, params ...interface{}) *mqrpc.Future {
+	return c.rpc.CallAsync(ctx, _func, params...)
+}
+
+// CallInto 调用成功后将结果解码到out中
+func (c *serverSession) CallInto(ctx context.Context, _func string, out interface{}, params ...interface{}) error {
+	return c.rpc.CallInto(ctx, _func, out, params...)
+}
+
+/**
+消息请求 需要回复,错误以*mqrpc.Error返回
+*/
+func (c *serverSession) CallArgsE(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, error) {
+	return c.rpc.CallArgsE(ctx, _func, ArgsType, args)
+}
+
+/**
+流式请求
+*/
+func (c *serverSession) CallStream(ctx context.Context, _func string, params ...interface{}) (mqrpc.Stream, error) {
+	return c.rpc.CallStream(ctx, _func, params...)
+}
@@ -74,6 +74,9 @@ func (m *BaseModule) GetSubclass() module.RPCModule {
 
 // GetServer server.Server
 func (m *BaseModule) GetServer() server.Server {
+	if m.service == nil {
+		return nil
+	}
 	return m.service.Server()
 }
 
@@ -114,6 +117,10 @@ func (m *BaseModule) OnInit(subclass module.RPCModule, app module.App, settings
 		opt = append(opt, server.RegisterTTL(app.Options().RegisterTTL))
 	}
 
+	if opts.DrainGrace == 0 {
+		opt = append(opt, server.DrainGrace(app.Options().DrainGrace))
+	}
+
 	if len(opts.Name) == 0 {
 		opt = append(opt, server.Name(subclass.GetType()))
 	}
@@ -125,6 +132,12 @@ func (m *BaseModule) OnInit(subclass module.RPCModule, app module.App, settings
 	if len(opts.Version) == 0 {
 		opt = append(opt, server.Version(subclass.Version()))
 	}
+
+	if opts.GoroutineControl == nil {
+		if pool := newPool(app); pool != nil {
+			opt = append(opt, server.GoroutineControl(pool))
+		}
+	}
 	server := server.NewServer(opt...)
 	err := server.OnInit(subclass, app, settings)
 	if err != nil {
@@ -238,6 +251,26 @@ func (m *BaseModule) Call(ctx context.Context, moduleType, _func string, param m
 	return m.App.Call(ctx, moduleType, _func, param, opts...)
 }
 
+// CallE  与Call相同,错误以*mqrpc.Error返回
+func (m *BaseModule) CallE(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (interface{}, error) {
+	return m.App.CallE(ctx, moduleType, _func, param, opts...)
+}
+
+// CallAsync  异步调用,立即返回Future
+func (m *BaseModule) CallAsync(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) *mqrpc.Future {
+	return m.App.CallAsync(ctx, moduleType, _func, param, opts...)
+}
+
+// CallInto  调用成功后将结果解码到out中
+func (m *BaseModule) CallInto(ctx context.Context, moduleType, _func string, out interface{}, param mqrpc.ParamOption, opts ...selector.SelectOption) error {
+	return m.App.CallInto(ctx, moduleType, _func, out, param, opts...)
+}
+
+// CallAll  并行调用moduleType类型的所有节点
+func (m *BaseModule) CallAll(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...module.CallAllOption) ([]module.NodeResult, error) {
+	return m.App.CallAll(ctx, moduleType, _func, param, opts...)
+}
+
 // RpcCall  RpcCall
 // Deprecated: 因为命名规范问题函数将废弃,请用Call代替
 func (m *BaseModule) RpcCall(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (interface{}, string) {
@@ -285,8 +318,32 @@ func (m *BaseModule) OnComplete(fn string, callInfo *mqrpc.CallInfo, result *rpc
 	}
 }
 
-// GetExecuting GetExecuting
+// GetExecuting 正在执行的handler数量
 func (m *BaseModule) GetExecuting() int64 {
-	return 0
-	//return m.GetServer().GetRPCServer().GetExecuting()
+	return m.GetServer().GetRPCServer().GetExecuting()
+}
+
+// GetPoolStats 协程池的实时计数,没有使用协程池时返回false
+func (m *BaseModule) GetPoolStats() (mqrpc.PoolStats, bool) {
+	if executor, ok := m.GetServer().Options().GoroutineControl.(mqrpc.Executor); ok {
+		return executor.Stats(), true
+	}
+	return mqrpc.PoolStats{}, false
+}
+
+/**
+按照配置创建模块的协程池
+协程池需要通过RPCMaxCoroutine显式开启,小于等于0时不限制
+*/
+func newPool(app module.App) *mqrpc.Pool {
+	opts := app.Options()
+	workers := opts.RPCMaxCoroutine
+	if workers <= 0 {
+		return nil
+	}
+	queueSize := opts.RPCQueueSize
+	if queueSize == 0 {
+		queueSize = mqrpc.DefaultPoolQueueSize
+	}
+	return mqrpc.NewPool(workers, queueSize, opts.RPCOverload)
 }
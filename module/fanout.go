@@ -0,0 +1,43 @@
+package module
+
+import (
+	"github.com/liangdas/mqant/selector"
+)
+
+// CallAllOptions 并行调用所有节点的配置项
+type CallAllOptions struct {
+	Filters []selector.Filter //筛选需要调用的节点
+	Quorum  int               //至少需要多少个节点调用成功,0表示不要求
+	First   int               //收到多少个成功结果后立即返回并取消其他调用,0表示等待全部节点
+}
+
+// CallAllOption 并行调用配置项
+type CallAllOption func(*CallAllOptions)
+
+// NodeResult 单个节点的调用结果
+type NodeResult struct {
+	NodeID string
+	Result interface{}
+	Err    error
+}
+
+// CallAllFilter 只调用经过筛选的节点
+func CallAllFilter(filters ...selector.Filter) CallAllOption {
+	return func(o *CallAllOptions) {
+		o.Filters = append(o.Filters, filters...)
+	}
+}
+
+// CallAllQuorum 成功的节点数少于n时返回错误
+func CallAllQuorum(n int) CallAllOption {
+	return func(o *CallAllOptions) {
+		o.Quorum = n
+	}
+}
+
+// CallAllFirst 收到n个成功结果后立即返回,未完成的调用会被取消
+func CallAllFirst(n int) CallAllOption {
+	return func(o *CallAllOptions) {
+		o.First = n
+	}
+}
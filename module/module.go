@@ -21,7 +21,7 @@ import (
 	"github.com/liangdas/mqant/registry"
 	"github.com/liangdas/mqant/rpc"
 	"github.com/liangdas/mqant/selector"
-	"github.com/nats-io/nats.go"
+	"github.com/liangdas/mqant/transport"
 )
 
 // ProtocolMarshal 数据包装
@@ -45,6 +45,11 @@ type ServerSession interface {
 	CallNR(_func string, params ...interface{}) (err error)
 	CallArgs(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, string)
 	CallNRArgs(_func string, ArgsType []string, args [][]byte) (err error)
+	CallE(ctx context.Context, _func string, params ...interface{}) (interface{}, error)
+	CallInto(ctx context.Context, _func string, out interface{}, params ...interface{}) error
+	CallAsync(ctx context.Context, _func string, params ...interface{}) *mqrpc.Future
+	CallArgsE(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, error)
+	CallStream(ctx context.Context, _func string, params ...interface{}) (mqrpc.Stream, error)
 }
 
 //App mqant应用定义
@@ -56,7 +61,9 @@ type App interface {
 	OnInit(settings conf.Config) error
 	OnDestroy() error
 	Options() Options
-	Transport() *nats.Conn
+	Transport() transport.Transport
+	// NatsConn 根据配置文件创建的nats连接,通过module.Nats或者module.Transport传入时为nil
+	NatsConn() *transport.NatsConn
 	Registry() registry.Registry
 	// Deprecated: 因为命名规范问题函数将废弃,请用GetServerByID代替
 	GetServerById(id string) (ServerSession, error)
@@ -67,6 +74,10 @@ type App interface {
 	*/
 	GetRouteServer(filter string, opts ...selector.SelectOption) (ServerSession, error) //获取经过筛选过的服务
 	GetServersByType(Type string) []ServerSession
+	// GetQueueServer 通过队列组调用moduleType的任意一个节点,由nats选择节点,不查询注册中心
+	// 服务方需要开启QueueGroup,只适用于无状态的handler
+	// 流确认与取消消息发送到应答中返回的节点地址,普通调用还没有收到应答,取消时不通知服务端
+	GetQueueServer(moduleType string) (ServerSession, error)
 	GetSettings() conf.Config //获取配置信息
 
 	// Deprecated: 因为命名规范问题函数将废弃,请用Invoke代替
@@ -79,6 +90,14 @@ type App interface {
 	Invoke(module RPCModule, moduleType string, _func string, params ...interface{}) (interface{}, string)
 	InvokeNR(module RPCModule, moduleType string, _func string, params ...interface{}) error
 	Call(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (interface{}, string)
+	// CallE 与Call相同,错误以*mqrpc.Error返回
+	CallE(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (interface{}, error)
+	// CallInto 调用成功后将结果解码到out中,out必须是指针
+	CallInto(ctx context.Context, moduleType, _func string, out interface{}, param mqrpc.ParamOption, opts ...selector.SelectOption) error
+	// CallAsync 异步调用,立即返回Future,通过ctx取消
+	CallAsync(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) *mqrpc.Future
+	// CallAll 并行调用moduleType类型的所有节点,返回每个节点的结果
+	CallAll(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...CallAllOption) ([]NodeResult, error)
 
 	/**
 	添加一个 自定义参数序列化接口
@@ -145,6 +164,15 @@ type RPCModule interface {
 	//	param 		mqrpc.ParamOption			方法传参
 	//	opts ...selector.SelectOption			服务发现模块过滤，可以用来选择调用哪个服务节点
 	Call(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (interface{}, string)
+	// CallE 与Call相同,错误以*mqrpc.Error返回,可以通过错误码区分错误类型
+	CallE(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) (interface{}, error)
+	// CallInto 调用成功后将结果解码到out中,out必须是指针
+	CallInto(ctx context.Context, moduleType, _func string, out interface{}, param mqrpc.ParamOption, opts ...selector.SelectOption) error
+	// CallAsync 异步调用,立即返回Future,结果通过Future.Result或者Future.Done获取,通过ctx取消
+	CallAsync(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...selector.SelectOption) *mqrpc.Future
+	//	CallAll 在同一个超时时间内并行调用moduleType类型的所有节点
+	//	opts	CallAllFilter 筛选节点, CallAllQuorum 最少成功数, CallAllFirst 收到N个成功结果后立即返回
+	CallAll(ctx context.Context, moduleType, _func string, param mqrpc.ParamOption, opts ...CallAllOption) ([]NodeResult, error)
 	GetModuleSettings() (settings *conf.ModuleSettings)
 	/**
 	filter		 调用者服务类型    moduleType|moduleType@moduleID
@@ -5,10 +5,13 @@ import (
 
 	"github.com/liangdas/mqant/conf"
 	"github.com/liangdas/mqant/logv2"
+	"github.com/liangdas/mqant/metrics"
 	"github.com/liangdas/mqant/registry"
 	mqrpc "github.com/liangdas/mqant/rpc"
 	rpcpb "github.com/liangdas/mqant/rpc/pb"
 	"github.com/liangdas/mqant/selector"
+	"github.com/liangdas/mqant/tracing"
+	"github.com/liangdas/mqant/transport"
 	"github.com/nats-io/nats.go"
 )
 
@@ -17,7 +20,8 @@ type Option func(*Options)
 
 // Options 应用级别配置项
 type Options struct {
-	Nats        *nats.Conn
+	Nats        *nats.Conn          //通过module.Nats传入或者根据配置文件创建的连接;后者被关闭重建后以App.NatsConn().Conn()为准
+	Transport   transport.Transport //RPC消息通道,默认使用Nats创建
 	Version     string
 	Debug       bool
 	Parse       bool //是否由框架解析启动环境变量,默认为true
@@ -35,8 +39,17 @@ type Options struct {
 	ClientRPChandler   ClientRPCHandler
 	ServerRPCHandler   ServerRPCHandler
 	RpcCompleteHandler RpcCompleteHandler
+	ClientInterceptors []mqrpc.ClientInterceptor //客户端拦截器,按顺序包装每一次RPC调用
 	RPCExpired         time.Duration
-	RPCMaxCoroutine    int
+	RPCMaxCoroutine    int                  //单个节点RegisterGO注册的handler同时执行的上限,小于等于0不限制(默认)
+	RPCQueueSize       int                  //协程池已满时最多排队的请求数,0为mqrpc.DefaultPoolQueueSize,小于0表示不排队
+	RPCOverload        mqrpc.OverloadPolicy //排队已满时的处理策略,默认阻塞接收协程,期间取消、流确认等控制消息也无法处理
+	Metrics            *metrics.RPCMetrics  //RPC调用指标,为空时不统计
+	Tracer             *tracing.Tracer      //调用链追踪,为空时不创建span
+	DrainGrace         time.Duration        //模块下线前标记为draining后继续处理请求的宽限期,默认不等待
+	RetryPolicy        RetryPolicy          //App.Call调用失败后的重试策略,默认不重试
+	LocalRPC           bool                 //调用方与服务方在同一进程时直接投递,不经过nats
+	QueueGroup         bool                 //节点地址使用 mqant.<type>.<id>,并以队列组方式订阅 mqant.<type>
 	AppConf            *conf.Options
 	Log                logv2.Logger
 }
@@ -89,6 +102,22 @@ func ProcessID(v string) Option {
 func Nats(nc *nats.Conn) Option {
 	return func(o *Options) {
 		o.Nats = nc
+		o.Transport = transport.NewNatsTransport(nc)
+	}
+}
+
+// Transport RPC消息通道,可以替换为transport/memory等非nats实现
+func Transport(t transport.Transport) Option {
+	return func(o *Options) {
+		o.Transport = t
+	}
+}
+
+// QueueGroup 模块的每个节点以队列组方式订阅 mqant.<type>,节点地址为 mqant.<type>.<id>
+// 开启后可以通过App.GetQueueServer调用无状态的handler,由nats选择节点,不需要查询注册中心
+func QueueGroup(enable bool) Option {
+	return func(o *Options) {
+		o.QueueGroup = enable
 	}
 }
 
@@ -150,6 +179,13 @@ func SetRpcCompleteHandler(t RpcCompleteHandler) Option {
 	}
 }
 
+// ClientInterceptor 添加客户端拦截器,先添加的拦截器位于外层
+func ClientInterceptor(interceptors ...mqrpc.ClientInterceptor) Option {
+	return func(o *Options) {
+		o.ClientInterceptors = append(o.ClientInterceptors, interceptors...)
+	}
+}
+
 //RPC超时时间
 func RPCExpired(t time.Duration) Option {
 	return func(o *Options) {
@@ -164,6 +200,56 @@ func RPCMaxCoroutine(t int) Option {
 	}
 }
 
+// RPCQueueSize 协程池已满时最多排队的请求数
+func RPCQueueSize(n int) Option {
+	return func(o *Options) {
+		o.RPCQueueSize = n
+	}
+}
+
+// RPCOverload 排队已满时的处理策略
+// OverloadBlock会阻塞接收新消息的协程,handler依赖流确认或者取消时应使用OverloadReject
+func RPCOverload(p mqrpc.OverloadPolicy) Option {
+	return func(o *Options) {
+		o.RPCOverload = p
+	}
+}
+
+// Metrics 统计RPC调用方与服务方的指标,通过metrics.RPCMetrics.Handler输出
+func Metrics(m *metrics.RPCMetrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+// Tracer 为网关消息、RPC调用与handler创建span,通过元数据中的traceparent串联
+func Tracer(t *tracing.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = t
+	}
+}
+
+// DrainGrace 模块下线前继续处理请求的宽限期,调用方的选择器在这段时间内更新节点列表
+func DrainGrace(t time.Duration) Option {
+	return func(o *Options) {
+		o.DrainGrace = t
+	}
+}
+
+// Retry App.Call/RPCModule.Call调用失败后的重试策略
+func Retry(p RetryPolicy) Option {
+	return func(o *Options) {
+		o.RetryPolicy = p
+	}
+}
+
+// LocalRPC 同一进程内的模块间RPC调用是否直接投递,不经过nats
+func LocalRPC(t bool) Option {
+	return func(o *Options) {
+		o.LocalRPC = t
+	}
+}
+
 // WithAppConf app的应用级配置
 func WithAppConf(cc ...conf.Option) Option {
 	return func(o *Options) {
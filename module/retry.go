@@ -0,0 +1,68 @@
+package module
+
+import (
+	"time"
+
+	"github.com/liangdas/mqant/rpc"
+)
+
+// RetryPolicy 调用失败后的重试策略,重试时会尽量选择其他节点
+// 请求没有送达节点(Retryable的错误)时所有函数都会重试
+// 请求可能已经被执行的错误(例如超时)只有幂等函数才会重试
+type RetryPolicy struct {
+	MaxAttempts int                                 //最多调用次数(包含第一次),小于等于1表示不重试
+	Backoff     time.Duration                       //第一次重试前的等待时间,之后每次翻倍
+	MaxBackoff  time.Duration                       //等待时间的上限,0表示不限制
+	RetryOn     []int32                             //幂等函数遇到这些错误码时重试,为空时为CodeUnavailable和CodeDeadlineExceeded
+	Idempotent  func(moduleType, _func string) bool //判断函数是否幂等,为空时所有函数都视为非幂等
+}
+
+// ShouldRetry 第attempt次调用失败后是否应该重试
+func (p RetryPolicy) ShouldRetry(attempt int, moduleType, _func string, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if mqrpc.IsRetryable(err) {
+		return true
+	}
+	if p.Idempotent == nil || !p.Idempotent(moduleType, _func) {
+		return false
+	}
+	codes := p.RetryOn
+	if len(codes) == 0 {
+		codes = []int32{mqrpc.CodeUnavailable, mqrpc.CodeDeadlineExceeded}
+	}
+	code := mqrpc.ErrorCode(err)
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// BackoffFor 第attempt次调用失败后等待多久再重试
+func (p RetryPolicy) BackoffFor(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d > 0; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// IdempotentFuncs 返回一个判断函数,只有列出的函数是幂等的,格式为 "moduleType/func" 或者 "func"
+func IdempotentFuncs(funcs ...string) func(moduleType, _func string) bool {
+	set := make(map[string]bool, len(funcs))
+	for _, f := range funcs {
+		set[f] = true
+	}
+	return func(moduleType, _func string) bool {
+		return set[_func] || set[moduleType+"/"+_func]
+	}
+}
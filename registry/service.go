@@ -17,6 +17,14 @@ type Node struct {
 	Metadata map[string]string `json:"metadata"`
 }
 
+// MetadataDraining 节点正在下线时Metadata中的标记,值为"true",选择器不再选择该节点
+const MetadataDraining = "draining"
+
+// Draining 节点是否正在下线
+func (n *Node) Draining() bool {
+	return n.Metadata[MetadataDraining] == "true"
+}
+
 // Endpoint 服务节点信息
 type Endpoint struct {
 	Name     string            `json:"name"`
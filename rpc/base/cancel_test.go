@@ -0,0 +1,178 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	basemodule "github.com/liangdas/mqant/module/base"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/transport"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+// spyTransport 记录每个地址收到的消息数量
+type spyTransport struct {
+	transport.Transport
+	lock      sync.Mutex
+	published map[string]int
+}
+
+func (s *spyTransport) Publish(subject string, data []byte) error {
+	s.lock.Lock()
+	s.published[subject]++
+	s.lock.Unlock()
+	return s.Transport.Publish(subject, data)
+}
+
+func TestCancelSkipsReply(t *testing.T) {
+	spy := &spyTransport{Transport: memory.NewTransport(), published: map[string]int{}}
+	a := app.NewApp(module.Transport(spy), module.LocalRPC(false))
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	returned := make(chan bool, 1)
+	server.RegisterGO("query", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		defer func() { returned <- true }()
+		return "", nil
+	})
+	session, err := basemodule.NewServerSession(a, "test", &registry.Node{Id: "test@1", Address: server.Addr()})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer session.GetRPC().Done()
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := session.CallE(ctx, "query"); mqrpc.ErrorCode(err) != mqrpc.CodeCanceled {
+		t.Fatalf("Expected CodeCanceled, got %v", err)
+	}
+	select {
+	case <-returned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the handler to be canceled")
+	}
+	time.Sleep(time.Millisecond * 50)
+	// 除了请求与取消消息之外,服务端不应该再发送应答
+	spy.lock.Lock()
+	defer spy.lock.Unlock()
+	for subject, n := range spy.published {
+		if subject != server.Addr() {
+			t.Fatalf("Expected no reply for a canceled call, got %d messages to %s", n, subject)
+		}
+	}
+	if n := spy.published[server.Addr()]; n != 2 {
+		t.Fatalf("Expected the request and the cancel message, got %d", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	for _, local := range []bool{false, true} {
+		server, session, done := newTestSession(t, module.LocalRPC(local))
+		canceled := make(chan error, 1)
+		server.RegisterGO("query", func(ctx context.Context) (string, error) {
+			select {
+			case <-ctx.Done():
+				canceled <- ctx.Err()
+			case <-time.After(5 * time.Second):
+				canceled <- nil
+			}
+			return "", nil
+		})
+
+		// 不设置超时,handler的ctx只会被调用方的取消消息取消
+		ctx, cancel := context.WithCancel(context.TODO())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err := session.CallE(ctx, "query")
+		if mqrpc.ErrorCode(err) != mqrpc.CodeCanceled {
+			t.Fatalf("Expected CodeCanceled, got %v", err)
+		}
+		select {
+		case err := <-canceled:
+			if err != context.Canceled {
+				t.Fatalf("Expected the handler context to be canceled by the caller, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the handler to be canceled after the caller gave up")
+		}
+		done()
+	}
+}
+
+func TestCancelQueued(t *testing.T) {
+	server, session, done := newTestSession(t)
+	defer done()
+	server.SetGoroutineControl(mqrpc.NewPool(1, 10, mqrpc.OverloadReject))
+	release := make(chan bool)
+	var ran int32
+	server.RegisterGO("block", func() (string, error) {
+		<-release
+		return "", nil
+	})
+	server.RegisterGO("queued", func() (string, error) {
+		atomic.AddInt32(&ran, 1)
+		return "", nil
+	})
+
+	// block占用唯一的协程,queued在协程池中排队
+	first := session.CallAsync(context.TODO(), "block")
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.TODO())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := session.CallE(ctx, "queued"); mqrpc.ErrorCode(err) != mqrpc.CodeCanceled {
+		t.Fatalf("Expected CodeCanceled, got %v", err)
+	}
+	// 等待取消消息到达服务端
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if _, err := first.Result(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&ran); n != 0 {
+		t.Fatalf("A call canceled while queued should not run, ran %d times", n)
+	}
+}
+
+func TestCancelBehindSerial(t *testing.T) {
+	server, session, done := newTestSession(t, module.LocalRPC(false))
+	defer done()
+	release := make(chan bool)
+	var ran int32
+	server.Register("block", func() (string, error) {
+		<-release
+		return "", nil
+	})
+	server.Register("queued", func() (string, error) {
+		atomic.AddInt32(&ran, 1)
+		return "", nil
+	})
+
+	// Register注册的block阻塞处理协程,queued在队列中等待
+	first := session.CallAsync(context.TODO(), "block")
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.TODO())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := session.CallE(ctx, "queued"); mqrpc.ErrorCode(err) != mqrpc.CodeCanceled {
+		t.Fatalf("Expected CodeCanceled, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if _, err := first.Result(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&ran); n != 0 {
+		t.Fatalf("A call canceled behind a serial handler should not run, ran %d times", n)
+	}
+}
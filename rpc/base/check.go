@@ -0,0 +1,98 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package defaultrpc
+
+import (
+	"fmt"
+	"reflect"
+
+	argsutil "github.com/liangdas/mqant/rpc/util"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	stringType = reflect.TypeOf("")
+)
+
+/**
+检查handler的签名
+func([ctx context.Context,] args...) (result, err)  err 为string或者error
+func([ctx context.Context,] args..., stream mqrpc.Stream) error
+参数必须能被argsutil、mqrpc.Marshaler、proto.Message或者注册的RPCSerialize解码,返回值必须能被编码
+*/
+func (s *RPCServer) checkFunction(f interface{}) error {
+	if f == nil {
+		return fmt.Errorf("handler is nil")
+	}
+	fType := reflect.TypeOf(f)
+	if fType.Kind() != reflect.Func {
+		return fmt.Errorf("handler must be a function, got %v", fType)
+	}
+	if reflect.ValueOf(f).IsNil() {
+		return fmt.Errorf("handler is nil")
+	}
+	if fType.IsVariadic() {
+		return fmt.Errorf("variadic handler %v is not supported", fType)
+	}
+	first, last := 0, fType.NumIn()
+	if last > 0 && fType.In(0) == contextType {
+		first = 1
+	}
+	stream := last > first && fType.In(last-1) == streamType
+	if stream {
+		last--
+	}
+	for i := first; i < last; i++ {
+		t := fType.In(i)
+		if t == contextType {
+			return fmt.Errorf("context.Context must be the first param of %v", fType)
+		}
+		if t == streamType {
+			return fmt.Errorf("mqrpc.Stream must be the last param of %v", fType)
+		}
+		if !argsutil.CanDecode(s.app, t) {
+			return fmt.Errorf("param %d type %v can not be decoded, use a type supported by argsutil, mqrpc.Marshaler, proto.Message or register a RPCSerialize", i, t)
+		}
+	}
+	switch {
+	case stream && fType.NumOut() == 1:
+		if !isErrorType(fType.Out(0)) {
+			return fmt.Errorf("stream handler must return error, got %v", fType)
+		}
+	case fType.NumOut() == 2:
+		if !isErrorType(fType.Out(1)) {
+			return fmt.Errorf("the second return value must be string or error, got %v", fType.Out(1))
+		}
+		if !argsutil.CanEncode(s.app, fType.Out(0)) {
+			return fmt.Errorf("result type %v can not be encoded, use a type supported by argsutil, a mqrpc.Marshaler or proto.Message pointer or register a RPCSerialize", fType.Out(0))
+		}
+	default:
+		return fmt.Errorf("handler must return (result, err), got %v", fType)
+	}
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isErrorType(t reflect.Type) bool {
+	return t == stringType || t.Implements(errorType)
+}
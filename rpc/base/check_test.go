@@ -0,0 +1,55 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/log"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/rpc/pb"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+type unknownStruct struct {
+	Name string
+}
+
+func TestRegisterValidation(t *testing.T) {
+	a := app.NewApp(module.Transport(memory.NewTransport()))
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	invalid := map[string]interface{}{
+		"not a function":    "hello",
+		"nil function":      (func() (string, error))(nil),
+		"unsupported param": func(s unknownStruct) (string, error) { return "", nil },
+		"unsupported chan":  func(c chan int) (string, error) { return "", nil },
+		"misplaced context": func(s string, ctx context.Context) (string, error) { return "", nil },
+		"one return value":  func(s string) string { return "" },
+		"bad error type":    func(s string) (string, int) { return "", 0 },
+		"unencodable":       func() (unknownStruct, error) { return unknownStruct{}, nil },
+		"variadic":          func(s ...string) (string, error) { return "", nil },
+	}
+	for name, f := range invalid {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected %s to be rejected", name)
+				}
+			}()
+			server.Register(name, f)
+		}()
+	}
+
+	// 合法的handler
+	server.Register("ok", func(ctx context.Context, s string, m map[string]interface{}, b []byte) (interface{}, error) {
+		return nil, nil
+	})
+	server.RegisterGO("trace", func(span log.TraceSpan, f float64) (*rpcpb.ResultInfo, string) { return nil, "" })
+	server.RegisterGO("stream", func(n int64, stream mqrpc.Stream) error { return nil })
+}
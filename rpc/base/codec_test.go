@@ -0,0 +1,123 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	basemodule "github.com/liangdas/mqant/module/base"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/rpc/util"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+type testPlayer struct {
+	Name  string
+	Level int
+}
+
+func TestExtendedCodecs(t *testing.T) {
+	a := app.NewApp(module.Transport(memory.NewTransport()))
+	a.AddRPCSerialize("json", argsutil.NewJSONSerialize(testPlayer{}))
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	server.RegisterGO("describe", func(n int, u uint64, names []string, ids []int64, at time.Time, d time.Duration, p testPlayer) (string, error) {
+		return fmt.Sprintf("%d %d %v %v %d %v %s/%d", n, u, names, ids, at.Unix(), d, p.Name, p.Level), nil
+	})
+	server.RegisterGO("player", func(name string, level int) (*testPlayer, error) {
+		return &testPlayer{Name: name, Level: level}, nil
+	})
+	server.RegisterGO("ids", func(n int64) ([]int64, error) {
+		ids := make([]int64, n)
+		for i := range ids {
+			ids[i] = int64(i)
+		}
+		return ids, nil
+	})
+	session, err := basemodule.NewServerSession(a, "test", &registry.Node{
+		Id:      "test@1",
+		Address: server.Addr(),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer func() {
+		session.GetRPC().Done()
+		server.Done()
+	}()
+	// 等待订阅完成
+	time.Sleep(time.Millisecond * 50)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	result, err := session.CallE(ctx, "describe", 7, uint64(1)<<63, []string{"a", "b"}, []int64{1, 2}, time.Unix(1500000000, 0), 3*time.Second, testPlayer{Name: "lily", Level: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error calling describe: %v", err)
+	}
+	if expected := "7 9223372036854775808 [a b] [1 2] 1500000000 3s lily/3"; result != expected {
+		t.Fatalf("Expected %q, got %q", expected, result)
+	}
+
+	// 调用方传递int64,handler接收int
+	result, err = session.CallE(ctx, "player", "lily", int64(5))
+	if err != nil {
+		t.Fatalf("Unexpected error calling player: %v", err)
+	}
+	if p, ok := result.(*testPlayer); !ok || p.Name != "lily" || p.Level != 5 {
+		t.Fatalf("Expected *testPlayer, got %#v", result)
+	}
+
+	result, err = session.CallE(ctx, "ids", int64(3))
+	if err != nil {
+		t.Fatalf("Unexpected error calling ids: %v", err)
+	}
+	if ids, ok := result.([]int64); !ok || len(ids) != 3 || ids[2] != 2 {
+		t.Fatalf("Expected []int64, got %#v", result)
+	}
+}
+
+// durationSerialize 以字符串形式序列化time.Duration
+type durationSerialize struct{}
+
+func (durationSerialize) Serialize(param interface{}) (string, []byte, error) {
+	if d, ok := param.(time.Duration); ok {
+		return "dur", []byte(d.String()), nil
+	}
+	return "", nil, fmt.Errorf("not a duration")
+}
+
+func (durationSerialize) Deserialize(ptype string, b []byte) (interface{}, error) {
+	if ptype != "dur" {
+		return nil, fmt.Errorf("not a duration")
+	}
+	return time.ParseDuration(string(b))
+}
+
+func (durationSerialize) GetTypes() []string { return []string{"dur"} }
+
+func TestRegisteredSerializeFirst(t *testing.T) {
+	a := app.NewApp(module.Transport(memory.NewTransport()))
+	a.AddRPCSerialize("dur", durationSerialize{})
+	ptype, b, err := argsutil.ArgsTypeAnd2Bytes(a, 3*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding duration: %v", err)
+	}
+	if ptype != "dur" || string(b) != "3s" {
+		t.Fatalf("Expected registered serializer to be used, got %s %q", ptype, b)
+	}
+	v, err := argsutil.Bytes2Args(a, ptype, b)
+	if err != nil || v != 3*time.Second {
+		t.Fatalf("Expected 3s, got %v %v", v, err)
+	}
+	// 没有注册的序列化器能处理时使用内置编码
+	ptype, _, err = argsutil.ArgsTypeAnd2Bytes(a, uint(1))
+	if err != nil || ptype != argsutil.UINT {
+		t.Fatalf("Expected %s, got %s %v", argsutil.UINT, ptype, err)
+	}
+}
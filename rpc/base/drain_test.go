@@ -0,0 +1,43 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/rpc"
+)
+
+func TestDrain(t *testing.T) {
+	server, session, done := newTestSession(t)
+	defer done()
+	gate := make(chan struct{})
+	server.RegisterGO("slow", func(n int64) (int64, error) {
+		<-gate
+		return n, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		_, err := session.CallE(ctx, "slow", int64(1))
+		result <- err
+	}()
+	for i := 0; i < 100 && server.GetExecuting() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 下线中拒绝新的请求,调用方可以换一个节点重试
+	server.Drain()
+	_, err := session.CallE(ctx, "add", int64(1), int64(2))
+	if mqrpc.ErrorCode(err) != mqrpc.CodeUnavailable || !mqrpc.IsRetryable(err) {
+		t.Fatalf("Expected a retryable unavailable error while draining, got %v", err)
+	}
+
+	// 正在执行的请求不受影响
+	close(gate)
+	if err := <-result; err != nil {
+		t.Fatalf("In-flight call should complete while draining: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/registry/mock"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+func TestCallAll(t *testing.T) {
+	reg := mock.NewRegistry()
+	a := app.NewApp(module.Transport(memory.NewTransport()), module.Registry(reg))
+	service := &registry.Service{Name: "fanout", Version: "1.0.0"}
+	for i := 1; i <= 3; i++ {
+		server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+		if err != nil {
+			t.Fatalf("Unexpected error creating rpc server: %v", err)
+		}
+		defer server.Done()
+		id := fmt.Sprintf("fanout@%d", i)
+		delay := time.Duration(0)
+		if i == 3 {
+			delay = 2 * time.Second
+		}
+		server.RegisterGO("who", func() (string, error) {
+			time.Sleep(delay)
+			return id, nil
+		})
+		service.Nodes = append(service.Nodes, &registry.Node{Id: id, Address: server.Addr()})
+	}
+	reg.Register(service)
+	// 等待订阅完成
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 300*time.Millisecond)
+	results, err := a.CallAll(ctx, "fanout", "who", mqrpc.Param())
+	cancel()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.NodeID == "fanout@3" {
+			if mqrpc.ErrorCode(r.Err) != mqrpc.CodeDeadlineExceeded {
+				t.Fatalf("Expected deadline exceeded from %s, got %v", r.NodeID, r.Err)
+			}
+		} else if r.Err != nil || r.Result != r.NodeID {
+			t.Fatalf("Unexpected result from %s: %v %v", r.NodeID, r.Result, r.Err)
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.TODO(), 300*time.Millisecond)
+	_, err = a.CallAll(ctx, "fanout", "who", mqrpc.Param(), module.CallAllQuorum(3))
+	cancel()
+	if mqrpc.ErrorCode(err) != mqrpc.CodeUnavailable {
+		t.Fatalf("Expected quorum error, got %v", err)
+	}
+
+	start := time.Now()
+	results, err = a.CallAll(context.TODO(), "fanout", "who", mqrpc.Param(), module.CallAllFirst(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("CallAllFirst should return before the slow node, took %v", time.Since(start))
+	}
+	for _, r := range results {
+		if r.NodeID == "fanout@3" && mqrpc.ErrorCode(r.Err) != mqrpc.CodeCanceled {
+			t.Fatalf("Expected canceled from %s, got %v", r.NodeID, r.Err)
+		}
+	}
+
+	results, err = a.CallAll(context.TODO(), "fanout", "who", mqrpc.Param(), module.CallAllFilter(func(services []*registry.Service) []*registry.Service {
+		filtered := make([]*registry.Service, 0, len(services))
+		for _, s := range services {
+			filtered = append(filtered, &registry.Service{Name: s.Name, Version: s.Version, Nodes: s.Nodes[:1]})
+		}
+		return filtered
+	}))
+	if err != nil || len(results) != 1 || results[0].Result != "fanout@1" {
+		t.Fatalf("Unexpected filtered results: %v %v", results, err)
+	}
+
+	// 正在下线的节点在调用方的筛选之前被排除
+	drain := &registry.Service{Name: "fanout-drain", Version: "1.0.0", Nodes: []*registry.Node{
+		{Id: "fanout@1", Address: service.Nodes[0].Address, Metadata: map[string]string{registry.MetadataDraining: "true"}},
+		{Id: "fanout@2", Address: service.Nodes[1].Address},
+	}}
+	reg.Register(drain)
+	results, err = a.CallAll(context.TODO(), "fanout-drain", "who", mqrpc.Param(), module.CallAllFilter(func(services []*registry.Service) []*registry.Service {
+		filtered := make([]*registry.Service, 0, len(services))
+		for _, s := range services {
+			filtered = append(filtered, &registry.Service{Name: s.Name, Version: s.Version, Nodes: s.Nodes[:1]})
+		}
+		return filtered
+	}))
+	if err != nil || len(results) != 1 || results[0].Result != "fanout@2" {
+		t.Fatalf("Draining node should be skipped before the filters: %v %v", results, err)
+	}
+
+	_, err = a.CallAll(context.TODO(), "nobody", "who", mqrpc.Param())
+	if mqrpc.ErrorCode(err) != mqrpc.CodeUnavailable {
+		t.Fatalf("Expected unavailable, got %v", err)
+	}
+}
+
+func TestCallAllFirst(t *testing.T) {
+	reg := mock.NewRegistry()
+	var calls int32
+	release := make(chan bool)
+	// 其中一个调用不响应取消,CallAll不应该等待它
+	stuck := func(ctx context.Context, callInfo *mqrpc.CallInfo, invoker mqrpc.ClientInvoker) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		return invoker(ctx, callInfo)
+	}
+	defer close(release)
+	a := app.NewApp(module.Transport(memory.NewTransport()), module.Registry(reg), module.ClientInterceptor(stuck))
+	service := &registry.Service{Name: "first", Version: "1.0.0"}
+	for i := 1; i <= 3; i++ {
+		server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+		if err != nil {
+			t.Fatalf("Unexpected error creating rpc server: %v", err)
+		}
+		defer server.Done()
+		id := fmt.Sprintf("first@%d", i)
+		server.RegisterGO("who", func() (string, error) {
+			return id, nil
+		})
+		service.Nodes = append(service.Nodes, &registry.Node{Id: id, Address: server.Addr()})
+	}
+	reg.Register(service)
+	time.Sleep(time.Millisecond * 50)
+
+	start := time.Now()
+	results, err := a.CallAll(context.TODO(), "first", "who", mqrpc.Param(), module.CallAllFirst(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("CallAllFirst should not wait for the remaining calls, took %v", time.Since(start))
+	}
+	succeeded, canceled := 0, 0
+	for _, r := range results {
+		if r.Err == nil && r.Result == r.NodeID {
+			succeeded++
+		} else if mqrpc.ErrorCode(r.Err) == mqrpc.CodeCanceled {
+			canceled++
+		}
+	}
+	if succeeded != 2 || canceled != 1 {
+		t.Fatalf("Expected 2 results and 1 canceled call, got %+v", results)
+	}
+}
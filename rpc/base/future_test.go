@@ -0,0 +1,94 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/registry/mock"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/rpc/pb"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+func TestCallAsync(t *testing.T) {
+	var calls int32
+	server, session, done := newTestSession(t, module.SetClientRPChandler(func(app module.App, server registry.Node, rpcinfo *rpcpb.RPCInfo, result interface{}, err string, exec_time int64) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer done()
+	server.RegisterGO("nap", func(ms int64) (int64, error) {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return ms, nil
+	})
+
+	start := time.Now()
+	futures := make([]*mqrpc.Future, 5)
+	for i := range futures {
+		futures[i] = session.CallAsync(context.TODO(), "nap", int64(200))
+	}
+	for _, f := range futures {
+		result, err := f.Result()
+		if err != nil || result != int64(200) {
+			t.Fatalf("Unexpected result %v %v", result, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Fatalf("Async calls should run in parallel, took %v", elapsed)
+	}
+
+	var sum int
+	if err := session.CallAsync(context.TODO(), "add", int64(1), int64(2)).Into(&sum); err != nil || sum != 3 {
+		t.Fatalf("Unexpected Into result %v %v", sum, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	f := session.CallAsync(ctx, "nap", int64(1000))
+	cancel()
+	select {
+	case <-f.Done():
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("Canceled call should complete immediately")
+	}
+	if _, err := f.Result(); mqrpc.ErrorCode(err) != mqrpc.CodeCanceled {
+		t.Fatalf("Expected canceled, got %v", err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 7 {
+		t.Fatalf("ClientRPChandler should see every async call, got %d", n)
+	}
+}
+
+func TestAppCallAsync(t *testing.T) {
+	reg := mock.NewRegistry()
+	a := app.NewApp(module.Transport(memory.NewTransport()), module.Registry(reg))
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	server.RegisterGO("join", func(names []string) (string, error) {
+		return strings.Join(names, ","), nil
+	})
+	reg.Register(&registry.Service{Name: "async", Version: "1.0.0", Nodes: []*registry.Node{{Id: "async@1", Address: server.Addr()}}})
+	time.Sleep(time.Millisecond * 50)
+
+	// 返回后修改参数不影响本次调用
+	names := []string{"a", "b"}
+	f := a.CallAsync(context.TODO(), "async", "join", mqrpc.Param(names))
+	names[0] = "x"
+	if result, err := f.Result(); err != nil || result != "a,b" {
+		t.Fatalf("Expected a,b, got %v %v", result, err)
+	}
+
+	f = a.CallAsync(context.TODO(), "async", "join", mqrpc.Param(make(chan int)))
+	if _, err := f.Result(); mqrpc.ErrorCode(err) != mqrpc.CodeInvalidArgument {
+		t.Fatalf("Expected invalid argument, got %v", err)
+	}
+}
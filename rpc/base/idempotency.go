@@ -0,0 +1,168 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package defaultrpc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	mqrpc "github.com/liangdas/mqant/rpc"
+	rpcpb "github.com/liangdas/mqant/rpc/pb"
+)
+
+type idempotentEntry struct {
+	done    chan struct{}
+	window  time.Duration
+	result  *rpcpb.ResultInfo
+	expires time.Time
+}
+
+/**
+记录幂等handler最近的请求结果
+请求开始执行时登记,执行完成后保存应答,窗口期内重复的请求直接返回保存的应答
+*/
+type idempotencyCache struct {
+	lock      sync.Mutex
+	entries   map[string]*idempotentEntry
+	lastSweep time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		entries: make(map[string]*idempotentEntry),
+	}
+}
+
+/**
+请求去重的key,调用方设置了幂等key时使用幂等key,否则使用Cid
+*/
+func idempotencyKey(callInfo *mqrpc.CallInfo) string {
+	if key := callInfo.GetMetadata(mqrpc.IdempotencyKey); key != "" {
+		return fmt.Sprintf("%s/key/%s", callInfo.RPCInfo.Fn, key)
+	}
+	return fmt.Sprintf("%s/cid/%s", callInfo.RPCInfo.Fn, callInfo.RPCInfo.Cid)
+}
+
+/**
+登记一个请求
+first 为true表示是第一次收到该请求,需要执行handler;否则返回已有的记录
+*/
+func (c *idempotencyCache) begin(key string, window time.Duration) (entry *idempotentEntry, first bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.sweep(now)
+	if entry, ok := c.entries[key]; ok {
+		if entry.result == nil || now.Before(entry.expires) {
+			return entry, false
+		}
+	}
+	entry = &idempotentEntry{
+		done:   make(chan struct{}),
+		window: window,
+	}
+	c.entries[key] = entry
+	return entry, true
+}
+
+/**
+保存执行结果,只有第一次调用生效
+*/
+func (c *idempotencyCache) complete(key string, result *rpcpb.ResultInfo) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.result != nil {
+		return
+	}
+	entry.result = proto.Clone(result).(*rpcpb.ResultInfo)
+	entry.expires = time.Now().Add(entry.window)
+	close(entry.done)
+}
+
+/**
+handler没有执行(例如排队期间已经超时),删除记录,后续的重试可以重新执行
+*/
+func (c *idempotencyCache) abort(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.result != nil {
+		return
+	}
+	delete(c.entries, key)
+	close(entry.done)
+}
+
+/**
+清理过期的记录,调用方需要持有锁
+*/
+func (c *idempotencyCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Second {
+		return
+	}
+	c.lastSweep = now
+	for key, entry := range c.entries {
+		if entry.result != nil && now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+/**
+设置handler为幂等的,window 时间内相同Cid或者相同幂等key的请求只执行一次
+重复的请求直接返回第一次执行的应答,第一次执行还没有完成时等待其完成
+*/
+func (s *RPCServer) Idempotent(id string, window time.Duration) {
+	s.functionsLock.Lock()
+	defer s.functionsLock.Unlock()
+	finfo, ok := s.functions[id]
+	if !ok {
+		panic(fmt.Sprintf("function id %v: not registered", id))
+	}
+	if finfo.Stream {
+		panic(fmt.Sprintf("function id %v: stream handler can not be idempotent", id))
+	}
+	cp := *finfo
+	cp.Idempotent = window
+	s.functions[id] = &cp
+}
+
+/**
+重复的请求,等待第一次执行完成后返回其应答
+*/
+func (s *RPCServer) replay(start time.Time, entry *idempotentEntry, callInfo *mqrpc.CallInfo) {
+	ctx, cancel := s.newContext(callInfo)
+	defer cancel()
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		s.onTimeOut(callInfo)
+		return
+	}
+	if entry.result == nil {
+		//第一次请求没有执行,调用方可以重试
+		e := mqrpc.NewError(mqrpc.CodeUnavailable, "duplicate request of %s was not executed", callInfo.RPCInfo.Fn)
+		e.Retryable = true
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, e)
+		return
+	}
+	result := proto.Clone(entry.result).(*rpcpb.ResultInfo)
+	result.Cid = callInfo.RPCInfo.Cid
+	callInfo.Result = result
+	callInfo.ExecTime = time.Since(start).Nanoseconds()
+	s.doCallback(callInfo)
+}
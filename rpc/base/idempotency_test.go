@@ -0,0 +1,76 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+)
+
+func TestIdempotent(t *testing.T) {
+	// 模拟消息被重复投递,同一个Cid发送两次
+	resend := func(ctx context.Context, callInfo *mqrpc.CallInfo, invoker mqrpc.ClientInvoker) (interface{}, error) {
+		if _, err := invoker(ctx, callInfo); err != nil {
+			return nil, err
+		}
+		return invoker(ctx, callInfo)
+	}
+	server, session, done := newTestSession(t, module.ClientInterceptor(func(ctx context.Context, callInfo *mqrpc.CallInfo, invoker mqrpc.ClientInvoker) (interface{}, error) {
+		if callInfo.RPCInfo.Fn == "resend" {
+			callInfo.RPCInfo.Fn = "credit"
+			return resend(ctx, callInfo, invoker)
+		}
+		return invoker(ctx, callInfo)
+	}))
+	defer done()
+	var balance int64
+	server.RegisterGO("credit", func(amount int64) (int64, error) {
+		time.Sleep(100 * time.Millisecond)
+		return atomic.AddInt64(&balance, amount), nil
+	})
+	server.Idempotent("credit", 300*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	// 同一个幂等key并发调用,只执行一次
+	keyed := mqrpc.WithIdempotencyKey(ctx, "order-1")
+	var wg sync.WaitGroup
+	results := make([]interface{}, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := session.CallE(keyed, "credit", int64(10))
+			if err != nil {
+				t.Errorf("Unexpected error calling credit: %v", err)
+			}
+			results[i] = r
+		}(i)
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r != int64(10) {
+			t.Fatalf("Duplicates should replay the first result, got %v", results)
+		}
+	}
+
+	// 重复投递的Cid只执行一次
+	if r, err := session.CallE(ctx, "resend", int64(5)); err != nil || r != int64(15) {
+		t.Fatalf("Unexpected resend result %v %v", r, err)
+	}
+	if b := atomic.LoadInt64(&balance); b != 15 {
+		t.Fatalf("Expected balance 15, got %d", b)
+	}
+
+	// 超过窗口期后相同的key会重新执行
+	time.Sleep(350 * time.Millisecond)
+	ctx2, cancel2 := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel2()
+	if r, err := session.CallE(mqrpc.WithIdempotencyKey(ctx2, "order-1"), "credit", int64(10)); err != nil || r != int64(25) {
+		t.Fatalf("Expected the key to expire, got %v %v", r, err)
+	}
+}
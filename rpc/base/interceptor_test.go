@@ -0,0 +1,90 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+)
+
+func TestClientInterceptor(t *testing.T) {
+	var order []string
+	trace := func(name string) mqrpc.ClientInterceptor {
+		return func(ctx context.Context, callInfo *mqrpc.CallInfo, invoker mqrpc.ClientInvoker) (interface{}, error) {
+			order = append(order, name)
+			return invoker(ctx, callInfo)
+		}
+	}
+	intercept := func(ctx context.Context, callInfo *mqrpc.CallInfo, invoker mqrpc.ClientInvoker) (interface{}, error) {
+		switch callInfo.RPCInfo.Fn {
+		case "cached":
+			return "from cache", nil
+		case "denied":
+			return nil, fmt.Errorf("permission denied")
+		case "plus":
+			callInfo.RPCInfo.Fn = "add"
+		}
+		return invoker(ctx, callInfo)
+	}
+	_, session, done := newTestSession(t, module.ClientInterceptor(trace("a"), trace("b")), module.ClientInterceptor(intercept))
+	defer done()
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	result, err := session.CallE(ctx, "plus", int64(1), int64(2))
+	if err != nil || result != int64(3) {
+		t.Fatalf("Expected 3, got %v %v", result, err)
+	}
+	if len(order) != 2 || order[0] != "a" || order[1] != "b" {
+		t.Fatalf("Expected interceptors to run in order, got %v", order)
+	}
+	result, err = session.CallE(ctx, "cached")
+	if err != nil || result != "from cache" {
+		t.Fatalf("Expected from cache, got %v %v", result, err)
+	}
+	_, err = session.CallE(ctx, "denied")
+	if mqrpc.ErrorCode(err) != mqrpc.CodeRejected {
+		t.Fatalf("Expected CodeRejected, got %v", err)
+	}
+	if err := session.CallNR("denied"); err == nil {
+		t.Fatal("Expected CallNR to be rejected")
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	server, session, done := newTestSession(t)
+	defer done()
+	var order []string
+	server.Use(func(callInfo *mqrpc.CallInfo, args []interface{}, handler mqrpc.ServerHandler) (interface{}, error) {
+		order = append(order, "module")
+		result, err := handler(callInfo, args)
+		if mqrpc.ErrorCode(err) == mqrpc.CodeBusiness {
+			return nil, mqrpc.NewError(mqrpc.CodeRejected, "rewritten %s", err.Error())
+		}
+		return result, err
+	})
+	server.Register("mul", func(a int64, b int64) (int64, string) {
+		return a * b, ""
+	}, func(callInfo *mqrpc.CallInfo, args []interface{}, handler mqrpc.ServerHandler) (interface{}, error) {
+		order = append(order, "func")
+		// 替换参数
+		args[0] = args[0].(int64) * 10
+		return handler(callInfo, args)
+	})
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	result, err := session.CallE(ctx, "mul", int64(2), int64(3))
+	if err != nil || result != int64(60) {
+		t.Fatalf("Expected 60, got %v %v", result, err)
+	}
+	if len(order) != 2 || order[0] != "module" || order[1] != "func" {
+		t.Fatalf("Expected module middleware to wrap function middleware, got %v", order)
+	}
+	_, err = session.CallE(ctx, "echo", "")
+	if mqrpc.ErrorCode(err) != mqrpc.CodeRejected || err.Error() != "rewritten empty" {
+		t.Fatalf("Expected rewritten error, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package defaultrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/liangdas/mqant/log"
+	"github.com/liangdas/mqant/module"
+	mqrpc "github.com/liangdas/mqant/rpc"
+	rpcpb "github.com/liangdas/mqant/rpc/pb"
+	mqanttools "github.com/liangdas/mqant/utils"
+)
+
+// LocalClient 进程内RPC客户端,目标节点运行在当前进程时直接投递到LocalServer
+type LocalClient struct {
+	callinfos *mqanttools.BeeMap
+	app       module.App
+	session   module.ServerSession
+}
+
+func NewLocalClient(app module.App, session module.ServerSession) (client *LocalClient, err error) {
+	client = new(LocalClient)
+	client.session = session
+	client.app = app
+	client.callinfos = mqanttools.NewBeeMap()
+	return client, nil
+}
+
+/**
+获取目标节点对应的进程内服务
+未开启本地调用或者目标节点不在当前进程时返回nil
+*/
+func (c *LocalClient) server() *LocalServer {
+	if !c.app.Options().LocalRPC {
+		return nil
+	}
+	node := c.session.GetNode()
+	if node == nil {
+		return nil
+	}
+	return getLocalServer(node.Address)
+}
+
+/**
+目标节点是否运行在当前进程中
+*/
+func (c *LocalClient) IsLocal() bool {
+	return c.server() != nil
+}
+
+func (c *LocalClient) Delete(key string) (err error) {
+	c.callinfos.Delete(key)
+	return
+}
+
+func (c *LocalClient) Done() (err error) {
+	//清理 callinfos 列表
+	for key, clinetCallInfo := range c.callinfos.Items() {
+		if clinetCallInfo != nil {
+			//关闭管道
+			safeCloseResult(clinetCallInfo.(ClinetCallInfo).call)
+			//从Map中删除
+			c.callinfos.Delete(key)
+		}
+	}
+	return
+}
+
+/**
+消息请求
+*/
+func (c *LocalClient) Call(ctx context.Context, callInfo *mqrpc.CallInfo, callback chan *rpcpb.ResultInfo) error {
+	server := c.server()
+	if server == nil {
+		return fmt.Errorf("LocalServer not found")
+	}
+	var correlation_id = callInfo.RPCInfo.Cid
+
+	clinetCallInfo := &ClinetCallInfo{
+		correlation_id: correlation_id,
+		call:           callback,
+		timeout:        callInfo.RPCInfo.Expired,
+		stream:         callInfo.RPCInfo.Stream,
+	}
+	c.callinfos.Set(correlation_id, *clinetCallInfo)
+	err := server.Write(ctx, callInfo, c)
+	if err != nil {
+		c.callinfos.Delete(correlation_id)
+	}
+	return err
+}
+
+/**
+消息请求 不需要回复
+*/
+func (c *LocalClient) CallNR(ctx context.Context, callInfo *mqrpc.CallInfo) error {
+	server := c.server()
+	if server == nil {
+		return fmt.Errorf("LocalServer not found")
+	}
+	return server.Write(ctx, callInfo, c)
+}
+
+/**
+接收应答信息
+*/
+func (c *LocalClient) onResult(resultInfo *rpcpb.ResultInfo) error {
+	correlation_id := resultInfo.Cid
+	clinetCallInfo := c.callinfos.Get(correlation_id)
+	if clinetCallInfo != nil && clinetCallInfo.(ClinetCallInfo).stream && !resultInfo.EOS {
+		//流式调用的中间消息,保留回调等待后续消息
+		pushResult(clinetCallInfo.(ClinetCallInfo).call, resultInfo)
+		return nil
+	}
+	//删除
+	c.callinfos.Delete(correlation_id)
+	if clinetCallInfo != nil {
+		if clinetCallInfo.(ClinetCallInfo).call != nil {
+			sendResult(clinetCallInfo.(ClinetCallInfo).call, resultInfo)
+		}
+	} else if !isStreamResult(resultInfo) {
+		//可能客户端已超时了，但服务端处理完还给回调了
+		log.Warning("rpc callback no found : [%s]", correlation_id)
+	}
+	return nil
+}
+
+/**
+流式调用的消息
+调用方关闭流之后服务端收到取消消息之前发出的消息会在之后到达,直接丢弃
+*/
+func isStreamResult(resultInfo *rpcpb.ResultInfo) bool {
+	return resultInfo.Seq > 0 || resultInfo.EOS
+}
+
+/**
+投递结果并关闭管道
+调用方超时后可能已经关闭了管道,这里需要防止panic
+*/
+func sendResult(ch chan *rpcpb.ResultInfo, resultInfo *rpcpb.ResultInfo) {
+	defer func() {
+		if recover() != nil {
+			// send on closed channel
+		}
+	}()
+	ch <- resultInfo
+	close(ch)
+}
+
+/**
+投递流式调用的中间消息,不关闭管道
+服务端按窗口发送,管道容量足够时不会阻塞
+*/
+func pushResult(ch chan *rpcpb.ResultInfo, resultInfo *rpcpb.ResultInfo) {
+	defer func() {
+		if recover() != nil {
+			// send on closed channel
+		}
+	}()
+	select {
+	case ch <- resultInfo:
+	default:
+		log.Warning("rpc stream buffer full, drop message : [%s] seq %d", resultInfo.Cid, resultInfo.Seq)
+	}
+}
+
+func safeCloseResult(ch chan *rpcpb.ResultInfo) {
+	defer func() {
+		if recover() != nil {
+			// close(ch) panic occur
+		}
+	}()
+
+	close(ch) // panic if ch is closed
+}
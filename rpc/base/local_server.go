@@ -0,0 +1,101 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package defaultrpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	mqrpc "github.com/liangdas/mqant/rpc"
+	rpcpb "github.com/liangdas/mqant/rpc/pb"
+)
+
+// 当前进程中运行的RPCServer列表 key为节点地址(与registry.Node.Address一致)
+var localServers sync.Map
+
+// getLocalServer 获取运行在当前进程中的服务,不存在则返回nil
+func getLocalServer(addr string) *LocalServer {
+	if s, ok := localServers.Load(addr); ok {
+		return s.(*LocalServer)
+	}
+	return nil
+}
+
+// LocalServer 进程内RPC服务,调用方与服务方在同一个进程时不经过nats直接投递请求
+// 请求与nats收到的请求放入同一个队列,Register注册的handler保持串行执行
+type LocalServer struct {
+	addr      string
+	server    *RPCServer
+	done      chan bool
+	closeOnce sync.Once
+}
+
+func NewLocalServer(addr string, s *RPCServer) *LocalServer {
+	server := new(LocalServer)
+	server.server = s
+	server.addr = addr
+	server.done = make(chan bool)
+	localServers.Store(addr, server)
+	return server
+}
+
+func (s *LocalServer) Addr() string {
+	return s.addr
+}
+
+/**
+注销进程内服务
+*/
+func (s *LocalServer) Shutdown() (err error) {
+	s.closeOnce.Do(func() {
+		localServers.Delete(s.addr)
+		safeClose(s.done)
+	})
+	return
+}
+
+/**
+投递请求
+RPCInfo会被复制一份,保证与经过nats时一样调用双方不会共享同一个请求对象
+请求队列已满时最多等待到ctx结束,返回ctx.Err()
+*/
+func (s *LocalServer) Write(ctx context.Context, callInfo *mqrpc.CallInfo, client *LocalClient) error {
+	rpcInfo, ok := proto.Clone(callInfo.RPCInfo).(*rpcpb.RPCInfo)
+	if !ok {
+		return fmt.Errorf("clone rpcinfo fail")
+	}
+	req := &mqrpc.CallInfo{
+		RPCInfo: rpcInfo,
+		Props: map[string]interface{}{
+			"local_client": client,
+		},
+		Agent: s, //设置代理为LocalServer
+	}
+	select {
+	case <-s.done:
+		return fmt.Errorf("LocalServer is closed")
+	default:
+	}
+	return s.server.call(ctx, req)
+}
+
+func (s *LocalServer) Callback(callinfo *mqrpc.CallInfo) error {
+	client, ok := callinfo.Props["local_client"].(*LocalClient)
+	if !ok {
+		return fmt.Errorf("local_client not found")
+	}
+	return client.onResult(callinfo.Result)
+}
@@ -0,0 +1,109 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	basemodule "github.com/liangdas/mqant/module/base"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+// registerSerial 注册Register handler "serial",返回记录的最大并发执行数
+func registerSerial(server mqrpc.RPCServer) *int32 {
+	var running, max int32
+	server.Register("serial", func() (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return "", nil
+	})
+	return &max
+}
+
+func TestLocalSerial(t *testing.T) {
+	tr := memory.NewTransport()
+	a := app.NewApp(module.Transport(tr), module.LocalRPC(true))
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	max := registerSerial(server)
+	node := &registry.Node{Id: "test@1", Address: server.Addr()}
+	local, err := basemodule.NewServerSession(a, "test", node)
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer local.GetRPC().Done()
+	// 另一个不使用进程内调用的应用,请求经过消息通道
+	b := app.NewApp(module.Transport(tr), module.LocalRPC(false))
+	remote, err := basemodule.NewServerSession(b, "test", node)
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer remote.GetRPC().Done()
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, session := range []module.ServerSession{local, remote} {
+			wg.Add(1)
+			go func(session module.ServerSession) {
+				defer wg.Done()
+				if _, err := session.CallE(ctx, "serial"); err != nil {
+					t.Errorf("Unexpected error calling serial: %v", err)
+				}
+			}(session)
+		}
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(max); n != 1 {
+		t.Fatalf("Register handlers should never run concurrently, got %d", n)
+	}
+}
+
+func TestLocalQueueFull(t *testing.T) {
+	size := defaultrpc.CallQueueSize
+	defaultrpc.CallQueueSize = 1
+	server, session, done := newTestSession(t, module.LocalRPC(true))
+	defaultrpc.CallQueueSize = size
+	defer done()
+	release := make(chan bool)
+	server.Register("block", func() (string, error) {
+		<-release
+		return "", nil
+	})
+	defer close(release)
+
+	// 一个请求正在执行,一个请求占满队列
+	session.CallAsync(context.TODO(), "block")
+	time.Sleep(20 * time.Millisecond)
+	session.CallAsync(context.TODO(), "block")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := session.CallE(ctx, "block"); mqrpc.ErrorCode(err) != mqrpc.CodeDeadlineExceeded {
+		t.Fatalf("Expected CodeDeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("A full queue should not outlast the caller's deadline, took %v", elapsed)
+	}
+}
@@ -0,0 +1,69 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+)
+
+func TestMetadata(t *testing.T) {
+	for _, local := range []bool{true, false} {
+		server, session, done := newTestSession(t, module.LocalRPC(local))
+		defer done()
+		got := make(chan map[string]string, 1)
+		server.Use(func(callInfo *mqrpc.CallInfo, args []interface{}, handler mqrpc.ServerHandler) (interface{}, error) {
+			if callInfo.RPCInfo.Fn == "echo" {
+				got <- callInfo.Metadata()
+			}
+			return handler(callInfo, args)
+		})
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+		ctx = mqrpc.WithMetadata(ctx, map[string]string{"request-id": "1", "tenant": "a"})
+		ctx = mqrpc.AppendMetadata(ctx, "request-id", "2")
+		_, err := session.CallE(ctx, "echo", "hello")
+		cancel()
+		if err != nil {
+			t.Fatalf("Unexpected error calling echo: %v", err)
+		}
+		md := <-got
+		if md["request-id"] != "2" || md["tenant"] != "a" {
+			t.Fatalf("local=%v Unexpected metadata %v", local, md)
+		}
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	for _, local := range []bool{true, false} {
+		server, session, done := newTestSession(t, module.LocalRPC(local), module.RPCExpired(time.Second*10))
+		defer done()
+		server.RegisterGO("budget", func(ctx context.Context, key string) (string, error) {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				return "", fmt.Errorf("no deadline")
+			}
+			if time.Until(deadline) > time.Second {
+				return "", fmt.Errorf("deadline not inherited %v", time.Until(deadline))
+			}
+			return mqrpc.MetadataFromContext(ctx)[key], nil
+		})
+		server.RegisterGO("forward", func(ctx context.Context, key string) (string, error) {
+			// 使用收到的ctx继续调用,沿用剩余的超时时间和元数据
+			r, err := session.CallE(ctx, "budget", key)
+			if err != nil {
+				return "", err
+			}
+			return r.(string), nil
+		})
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*500)
+		ctx = mqrpc.AppendMetadata(ctx, "tenant", "a")
+		result, err := session.CallE(ctx, "forward", "tenant")
+		cancel()
+		if err != nil || result != "a" {
+			t.Fatalf("local=%v Expected a, got %v %v", local, result, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package defaultrpc_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/metrics"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.NewRPCMetrics(nil)
+	server, session, done := newTestSession(t, module.Metrics(m))
+	defer done()
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	if _, err := session.CallE(ctx, "add", int64(1), int64(2)); err != nil {
+		t.Fatalf("Unexpected error calling add: %v", err)
+	}
+	if _, err := session.CallE(ctx, "missing"); mqrpc.ErrorCode(err) != mqrpc.CodeNotFound {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	m.Registry().WriteText(&buf)
+	text := buf.String()
+	for _, line := range []string{
+		`mqant_rpc_client_calls_total{module="test",node="test@1",func="add"} 1`,
+		`mqant_rpc_client_errors_total{module="test",node="test@1",func="missing",code="3"} 1`,
+		`mqant_rpc_client_duration_seconds_count{module="test",node="test@1",func="add"} 1`,
+		`mqant_rpc_client_in_flight{module="test",node="test@1",func="add"} 0`,
+		`mqant_rpc_server_calls_total{module="test",node="` + server.Addr() + `",func="add"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("Expected %s in:\n%s", line, text)
+		}
+	}
+}
@@ -24,8 +24,8 @@ import (
 	"github.com/liangdas/mqant/module"
 	mqrpc "github.com/liangdas/mqant/rpc"
 	rpcpb "github.com/liangdas/mqant/rpc/pb"
+	"github.com/liangdas/mqant/transport"
 	mqanttools "github.com/liangdas/mqant/utils"
-	"github.com/nats-io/nats.go"
 )
 
 type NatsClient struct {
@@ -34,9 +34,7 @@ type NatsClient struct {
 	cmutex            sync.Mutex //操作callinfos的锁
 	callbackqueueName string
 	app               module.App
-	done              chan error
-	subs              *nats.Subscription
-	isClose           bool
+	done              chan bool
 	session           module.ServerSession
 }
 
@@ -45,9 +43,8 @@ func NewNatsClient(app module.App, session module.ServerSession) (client *NatsCl
 	client.session = session
 	client.app = app
 	client.callinfos = mqanttools.NewBeeMap()
-	client.callbackqueueName = nats.NewInbox()
-	client.done = make(chan error)
-	client.isClose = false
+	client.callbackqueueName = newInbox(app)
+	client.done = make(chan bool)
 	go client.on_request_handle()
 	return client, nil
 }
@@ -79,20 +76,33 @@ func (c *NatsClient) Done() (err error) {
 			c.callinfos.Delete(key)
 		}
 	}
-	c.callinfos = nil
-	c.done <- nil
-	c.isClose = true
+	safeClose(c.done)
 	return
 }
 
+/**
+是否已经关闭
+*/
+func (c *NatsClient) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 /**
 消息请求
 */
 func (c *NatsClient) Call(callInfo *mqrpc.CallInfo, callback chan *rpcpb.ResultInfo) error {
 	//var err error
-	if c.callinfos == nil {
+	if c.closed() {
 		return fmt.Errorf("AMQPClient is closed")
 	}
+	if c.app.Transport() == nil {
+		return fmt.Errorf("transport is nil")
+	}
 	callInfo.RPCInfo.ReplyTo = c.callbackqueueName
 	var correlation_id = callInfo.RPCInfo.Cid
 
@@ -100,6 +110,7 @@ func (c *NatsClient) Call(callInfo *mqrpc.CallInfo, callback chan *rpcpb.ResultI
 		correlation_id: correlation_id,
 		call:           callback,
 		timeout:        callInfo.RPCInfo.Expired,
+		stream:         callInfo.RPCInfo.Stream,
 	}
 	c.callinfos.Set(correlation_id, *clinetCallInfo)
 	body, err := c.Marshal(callInfo.RPCInfo)
@@ -113,11 +124,28 @@ func (c *NatsClient) Call(callInfo *mqrpc.CallInfo, callback chan *rpcpb.ResultI
 消息请求 不需要回复
 */
 func (c *NatsClient) CallNR(callInfo *mqrpc.CallInfo) error {
+	return c.CallNRTo(c.session.GetNode().Address, callInfo)
+}
+
+/**
+消息请求 不需要回复,发送到指定的地址
+*/
+func (c *NatsClient) CallNRTo(subject string, callInfo *mqrpc.CallInfo) error {
+	if c.app.Transport() == nil {
+		return fmt.Errorf("transport is nil")
+	}
 	body, err := c.Marshal(callInfo.RPCInfo)
 	if err != nil {
 		return err
 	}
-	return c.app.Transport().Publish(c.session.GetNode().Address, body)
+	return c.app.Transport().Publish(subject, body)
+}
+
+/**
+是否通过队列组地址调用,请求会投递给模块的任意一个节点
+*/
+func (c *NatsClient) isQueue() bool {
+	return c.session.GetNode().Address == transport.ModuleSubject(c.session.GetName())
 }
 
 /**
@@ -141,41 +169,55 @@ func (c *NatsClient) on_request_handle() (err error) {
 			fmt.Println(errstr)
 		}
 	}()
-	c.subs, err = c.app.Transport().SubscribeSync(c.callbackqueueName)
+	if c.app.Transport() == nil {
+		//未配置消息通道,只能使用进程内调用
+		return fmt.Errorf("transport is nil")
+	}
+	subs, err := c.app.Transport().SubscribeSync(c.callbackqueueName)
 	if err != nil {
 		return err
 	}
+	var lock sync.Mutex //保护重新订阅与注销
+	resubscribe := func() {
+		lock.Lock()
+		if c.closed() || subs.IsValid() {
+			lock.Unlock()
+			return
+		}
+		//订阅已关闭，需要重新订阅,否则之后的应答都收不到
+		n, err := c.app.Transport().SubscribeSync(c.callbackqueueName)
+		if err == nil {
+			subs = n
+		}
+		lock.Unlock()
+		if err != nil {
+			log.Error("NatsClient SubscribeSync error with '%v'", err)
+			waitResubscribe(c.done)
+		}
+	}
 
 	go func() {
 		<-c.done
-		c.subs.Unsubscribe()
+		lock.Lock()
+		subs.Unsubscribe()
+		lock.Unlock()
 	}()
 
-	for !c.isClose {
-		m, err := c.subs.NextMsg(time.Minute)
-		if err != nil && err == nats.ErrTimeout {
+	for !c.closed() {
+		m, err := subs.NextMsg(time.Minute)
+		if err != nil && err == transport.ErrTimeout {
 			//fmt.Println(err.Error())
 			//log.Warning("NatsServer error with '%v'",err)
-			if !c.subs.IsValid() {
-				//订阅已关闭，需要重新订阅
-				c.subs, err = c.app.Transport().SubscribeSync(c.callbackqueueName)
-				if err != nil {
-					log.Error("NatsClient SubscribeSync[1] error with '%v'", err)
-					continue
-				}
-			}
+			resubscribe()
 			continue
 		} else if err != nil {
+			if c.closed() {
+				//客户端已关闭,订阅是被主动注销的
+				break
+			}
 			fmt.Println(fmt.Sprintf("%v rpcclient error: %v", time.Now().String(), err.Error()))
 			log.Error("NatsClient error with '%v'", err)
-			if !c.subs.IsValid() {
-				//订阅已关闭，需要重新订阅
-				c.subs, err = c.app.Transport().SubscribeSync(c.callbackqueueName)
-				if err != nil {
-					log.Error("NatsClient SubscribeSync[2] error with '%v'", err)
-					continue
-				}
-			}
+			resubscribe()
 			continue
 		}
 
@@ -185,6 +227,11 @@ func (c *NatsClient) on_request_handle() (err error) {
 		} else {
 			correlation_id := resultInfo.Cid
 			clinetCallInfo := c.callinfos.Get(correlation_id)
+			if clinetCallInfo != nil && clinetCallInfo.(ClinetCallInfo).stream && !resultInfo.EOS {
+				//流式调用的中间消息,保留回调等待后续消息
+				pushResult(clinetCallInfo.(ClinetCallInfo).call, resultInfo)
+				continue
+			}
 			//删除
 			c.callinfos.Delete(correlation_id)
 			if clinetCallInfo != nil {
@@ -192,7 +239,7 @@ func (c *NatsClient) on_request_handle() (err error) {
 					clinetCallInfo.(ClinetCallInfo).call <- resultInfo
 					c.CloseFch(clinetCallInfo.(ClinetCallInfo).call)
 				}
-			} else {
+			} else if !isStreamResult(resultInfo) {
 				//可能客户端已超时了，但服务端处理完还给回调了
 				log.Warning("rpc callback no found : [%s]", correlation_id)
 			}
@@ -20,38 +20,31 @@ import (
 	"github.com/liangdas/mqant/module"
 	"github.com/liangdas/mqant/rpc"
 	"github.com/liangdas/mqant/rpc/pb"
-	"github.com/nats-io/nats.go"
+	"github.com/liangdas/mqant/transport"
 	"runtime"
-	"strings"
+	"sync"
 	"time"
 )
 
 type NatsServer struct {
 	call_chan chan mqrpc.CallInfo
 	addr      string
+	queue     string //模块地址,以队列组方式订阅,为空时不订阅
 	app       module.App
 	server    *RPCServer
 	done      chan bool
 	stopeds   chan bool
-	subs      *nats.Subscription
-	isClose   bool
 }
 
-func setAddrs(addrs []string) []string {
-	var cAddrs []string
-	for _, addr := range addrs {
-		if len(addr) == 0 {
-			continue
-		}
-		if !strings.HasPrefix(addr, "nats://") {
-			addr = "nats://" + addr
-		}
-		cAddrs = append(cAddrs, addr)
-	}
-	if len(cAddrs) == 0 {
-		cAddrs = []string{nats.DefaultURL}
+/**
+创建收件地址
+未配置消息通道时依然生成一个唯一地址,用于进程内调用
+*/
+func newInbox(app module.App) string {
+	if app.Transport() != nil {
+		return app.Transport().NewInbox()
 	}
-	return cAddrs
+	return transport.NewInbox()
 }
 
 func NewNatsServer(app module.App, s *RPCServer) (*NatsServer, error) {
@@ -59,15 +52,42 @@ func NewNatsServer(app module.App, s *RPCServer) (*NatsServer, error) {
 	server.server = s
 	server.done = make(chan bool)
 	server.stopeds = make(chan bool)
-	server.isClose = false
 	server.app = app
-	server.addr = nats.NewInbox()
+	server.addr = newInbox(app)
+	if app.Options().QueueGroup && app.Transport() != nil && s.module != nil && s.id != "" {
+		server.addr = transport.NodeSubject(s.module.GetType(), s.id)
+		server.queue = transport.ModuleSubject(s.module.GetType())
+	}
+	//节点地址与队列组地址各由一个协程接收,请求都放入RPCServer的同一个队列依次处理
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		server.on_request_handle()
+		defer wg.Done()
+		server.on_request_handle(server.addr, "")
+	}()
+	if server.queue != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.on_request_handle(server.queue, server.queue)
+		}()
+	}
+	go func() {
+		wg.Wait()
 		safeClose(server.stopeds)
 	}()
 	return server, nil
 }
+/**
+以队列组方式订阅时返回节点地址,调用方把控制消息发送到该地址
+*/
+func (s *NatsServer) nodeAddr() string {
+	if s.queue == "" {
+		return ""
+	}
+	return s.addr
+}
+
 func (s *NatsServer) Addr() string {
 	return s.addr
 }
@@ -87,7 +107,6 @@ func safeClose(ch chan bool) {
 */
 func (s *NatsServer) Shutdown() (err error) {
 	safeClose(s.done)
-	s.isClose = true
 	select {
 	case <-s.stopeds:
 		//等待nats注销完成
@@ -95,6 +114,18 @@ func (s *NatsServer) Shutdown() (err error) {
 	return
 }
 
+/**
+是否已经注销
+*/
+func (s *NatsServer) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *NatsServer) Callback(callinfo *mqrpc.CallInfo) error {
 	body, err := s.MarshalResult(callinfo.Result)
 	if err != nil {
@@ -104,10 +135,30 @@ func (s *NatsServer) Callback(callinfo *mqrpc.CallInfo) error {
 	return s.app.Transport().Publish(reply_to, body)
 }
 
+// ResubscribeWait 重新订阅失败后的等待时间,避免nats重新建立连接期间空转
+var ResubscribeWait = time.Second
+
+func waitResubscribe(done chan bool) {
+	select {
+	case <-done:
+	case <-time.After(ResubscribeWait):
+	}
+}
+
+/**
+订阅地址,queue不为空时以队列组方式订阅
+*/
+func (s *NatsServer) subscribe(subject, queue string) (transport.Subscription, error) {
+	if queue != "" {
+		return s.app.Transport().QueueSubscribeSync(subject, queue)
+	}
+	return s.app.Transport().SubscribeSync(subject)
+}
+
 /**
 接收请求信息
 */
-func (s *NatsServer) on_request_handle() (err error) {
+func (s *NatsServer) on_request_handle(subject, queue string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			var rn = ""
@@ -125,43 +176,58 @@ func (s *NatsServer) on_request_handle() (err error) {
 			fmt.Println(errstr)
 		}
 	}()
-	s.subs, err = s.app.Transport().SubscribeSync(s.addr)
+	if s.app.Transport() == nil {
+		//未配置消息通道,只能接收进程内调用
+		return fmt.Errorf("transport is nil")
+	}
+	subs, err := s.subscribe(subject, queue)
 	if err != nil {
 		return err
 	}
+	var lock sync.Mutex //保护重新订阅与注销
+	resubscribe := func() {
+		lock.Lock()
+		if s.closed() || subs.IsValid() {
+			lock.Unlock()
+			return
+		}
+		//订阅已关闭，需要重新订阅
+		n, err := s.subscribe(subject, queue)
+		if err == nil {
+			subs = n
+		}
+		lock.Unlock()
+		if err != nil {
+			//连接重建期间订阅会失败,稍后再试
+			log.Warning("NatsServer resubscribe %s error with '%v'", subject, err)
+			waitResubscribe(s.done)
+		}
+	}
 
 	go func() {
 		select {
 		case <-s.done:
 			//服务关闭
 		}
-		s.subs.Unsubscribe()
+		lock.Lock()
+		subs.Unsubscribe()
+		lock.Unlock()
 	}()
 
-	for !s.isClose {
-		m, err := s.subs.NextMsg(time.Minute)
-		if err != nil && err == nats.ErrTimeout {
+	for !s.closed() {
+		m, err := subs.NextMsg(time.Minute)
+		if err != nil && err == transport.ErrTimeout {
 			//fmt.Println(err.Error())
 			//log.Warning("NatsServer error with '%v'",err)
-			if !s.subs.IsValid() {
-				//订阅已关闭，需要重新订阅
-				s.subs, err = s.app.Transport().SubscribeSync(s.addr)
-				if err != nil {
-					// log.Error("NatsServer SubscribeSync[1] error with '%v'", err)
-					continue
-				}
-			}
+			resubscribe()
 			continue
 		} else if err != nil {
-			// log.Warning("NatsServer error with '%v'", err)
-			if !s.subs.IsValid() {
-				//订阅已关闭，需要重新订阅
-				s.subs, err = s.app.Transport().SubscribeSync(s.addr)
-				if err != nil {
-					// log.Error("NatsServer SubscribeSync[2] error with '%v'", err)
-					continue
-				}
+			if s.closed() {
+				//服务已关闭,订阅是被主动注销的
+				break
 			}
+			// log.Warning("NatsServer error with '%v'", err)
+			resubscribe()
 			continue
 		}
 
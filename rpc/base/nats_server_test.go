@@ -0,0 +1,110 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	basemodule "github.com/liangdas/mqant/module/base"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/transport"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+// flakyTransport 模拟nats连接关闭:注销所有订阅,恢复之前无法订阅
+type flakyTransport struct {
+	transport.Transport
+	lock sync.Mutex
+	subs []transport.Subscription
+	down bool
+}
+
+func (f *flakyTransport) track(sub transport.Subscription, err error) (transport.Subscription, error) {
+	if err == nil {
+		f.subs = append(f.subs, sub)
+	}
+	return sub, err
+}
+
+func (f *flakyTransport) SubscribeSync(subject string) (transport.Subscription, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.down {
+		return nil, errors.New("connection closed")
+	}
+	return f.track(f.Transport.SubscribeSync(subject))
+}
+
+func (f *flakyTransport) QueueSubscribeSync(subject, queue string) (transport.Subscription, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.down {
+		return nil, errors.New("connection closed")
+	}
+	return f.track(f.Transport.QueueSubscribeSync(subject, queue))
+}
+
+func (f *flakyTransport) setDown(down bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.down = down
+	if down {
+		for _, sub := range f.subs {
+			sub.Unsubscribe()
+		}
+		f.subs = nil
+	}
+}
+
+func TestResubscribe(t *testing.T) {
+	wait := defaultrpc.ResubscribeWait
+	defaultrpc.ResubscribeWait = time.Millisecond * 10
+	defer func() { defaultrpc.ResubscribeWait = wait }()
+
+	ft := &flakyTransport{Transport: memory.NewTransport()}
+	a := app.NewApp(module.Transport(ft), module.LocalRPC(false))
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	server.RegisterGO("add", func(a int64, b int64) (int64, error) {
+		return a + b, nil
+	})
+	session, err := basemodule.NewServerSession(a, "test", &registry.Node{Id: "test@1", Address: server.Addr()})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer session.GetRPC().Done()
+	time.Sleep(time.Millisecond * 50)
+
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*200)
+		defer cancel()
+		_, err := session.CallE(ctx, "add", int64(1), int64(2))
+		return err
+	}
+	if err := call(); err != nil {
+		t.Fatalf("Unexpected error before the connection drops: %v", err)
+	}
+
+	ft.setDown(true)
+	time.Sleep(time.Millisecond * 50)
+	ft.setDown(false)
+	// 服务端的请求订阅与客户端的应答订阅都需要重新订阅
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := call()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected calls to recover after resubscribing, got %v", err)
+		}
+	}
+}
@@ -19,4 +19,5 @@ type ClinetCallInfo struct {
 	correlation_id string
 	timeout        int64 //超时
 	call           chan *rpcpb.ResultInfo
+	stream         bool //流式调用,收到结束标记前会有多条应答
 }
@@ -0,0 +1,81 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/rpc"
+)
+
+func TestGoroutinePool(t *testing.T) {
+	waitStats := func(pool *mqrpc.Pool, executing, queued, overloaded int64) {
+		for i := 0; i < 100; i++ {
+			if s := pool.Stats(); s.Executing == executing && s.Queued == queued && s.Rejected+s.Shed == overloaded {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Unexpected pool stats %+v", pool.Stats())
+	}
+	for _, policy := range []mqrpc.OverloadPolicy{mqrpc.OverloadReject, mqrpc.OverloadShedOldest} {
+		server, session, done := newTestSession(t)
+		pool := mqrpc.NewPool(1, 1, policy)
+		server.SetGoroutineControl(pool)
+		gate := make(chan struct{})
+		server.RegisterGO("slow", func(n int64) (int64, error) {
+			<-gate
+			return n, nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+		errs := make([]error, 3)
+		var wg sync.WaitGroup
+		call := func(i int) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = session.CallE(ctx, "slow", int64(i))
+			}()
+		}
+		// 第一个请求执行,第二个请求排队,第三个请求超出队列
+		call(0)
+		waitStats(pool, 1, 0, 0)
+		if n := server.GetExecuting(); n != 1 {
+			t.Fatalf("Expected 1 executing handler, got %d", n)
+		}
+		call(1)
+		waitStats(pool, 1, 1, 0)
+		call(2)
+		waitStats(pool, 1, 1, 1)
+		close(gate)
+		wg.Wait()
+		cancel()
+
+		// reject拒绝最新的请求,shed_oldest丢弃排队的请求
+		overloaded := 2
+		if policy == mqrpc.OverloadShedOldest {
+			overloaded = 1
+		}
+		for i, err := range errs {
+			if i != overloaded {
+				if err != nil {
+					t.Fatalf("%v: unexpected error for call %d: %v", policy, i, err)
+				}
+				continue
+			}
+			if mqrpc.ErrorCode(err) != mqrpc.CodeOverloaded || !mqrpc.IsRetryable(err) {
+				t.Fatalf("%v: expected retryable overloaded error for call %d, got %v", policy, i, err)
+			}
+		}
+		waitStats(pool, 0, 0, 1)
+		if stats := pool.Stats(); stats.Completed != 2 {
+			t.Fatalf("%v: unexpected pool stats %+v", policy, stats)
+		}
+		if n := server.GetExecuting(); n != 0 {
+			t.Fatalf("Expected no executing handler, got %d", n)
+		}
+		done()
+	}
+}
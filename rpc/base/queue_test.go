@@ -0,0 +1,183 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	basemodule "github.com/liangdas/mqant/module/base"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+func TestQueueGroupSerial(t *testing.T) {
+	a := app.NewApp(module.Transport(memory.NewTransport()), module.QueueGroup(true), module.LocalRPC(false))
+	server, err := defaultrpc.NewRPCServerWithID(a, &testModule{app: a}, "n1")
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	max := registerSerial(server)
+	queue, err := a.GetQueueServer("test")
+	if err != nil {
+		t.Fatalf("Unexpected error creating queue session: %v", err)
+	}
+	defer queue.GetRPC().Done()
+	node, err := basemodule.NewServerSession(a, "test", &registry.Node{Id: "test@n1", Address: server.Addr()})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer node.GetRPC().Done()
+	time.Sleep(time.Millisecond * 50)
+
+	// 同时通过节点地址与队列组地址调用
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, session := range []module.ServerSession{queue, node} {
+			wg.Add(1)
+			go func(session module.ServerSession) {
+				defer wg.Done()
+				if _, err := session.CallE(ctx, "serial"); err != nil {
+					t.Errorf("Unexpected error calling serial: %v", err)
+				}
+			}(session)
+		}
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(max); n != 1 {
+		t.Fatalf("Register handlers should never run concurrently, got %d", n)
+	}
+}
+
+func TestQueueGroup(t *testing.T) {
+	a := app.NewApp(module.Transport(memory.NewTransport()), module.QueueGroup(true))
+	var servers []mqrpc.RPCServer
+	for _, id := range []string{"n1", "n2"} {
+		id := id
+		server, err := defaultrpc.NewRPCServerWithID(a, &testModule{app: a}, id)
+		if err != nil {
+			t.Fatalf("Unexpected error creating rpc server: %v", err)
+		}
+		if server.Addr() != "mqant.test."+id {
+			t.Fatalf("Expected the node subject mqant.test.%s, got %s", id, server.Addr())
+		}
+		server.RegisterGO("whoami", func() (string, error) {
+			return id, nil
+		})
+		servers = append(servers, server)
+		defer server.Done()
+	}
+	session, err := a.GetQueueServer("test")
+	if err != nil {
+		t.Fatalf("Unexpected error creating queue session: %v", err)
+	}
+	defer session.GetRPC().Done()
+	if s, _ := a.GetQueueServer("test"); s != session {
+		t.Fatal("Expected the queue session to be reused")
+	}
+	// 等待订阅完成
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	hits := map[string]int{}
+	for i := 0; i < 10; i++ {
+		result, err := session.CallE(ctx, "whoami")
+		if err != nil {
+			t.Fatalf("Unexpected error calling through the queue group: %v", err)
+		}
+		hits[result.(string)]++
+	}
+	if hits["n1"]+hits["n2"] != 10 || hits["n1"] == 0 || hits["n2"] == 0 {
+		t.Fatalf("Expected each call to be handled by exactly one node of the group, got %v", hits)
+	}
+
+	// 节点地址依然可以单独调用
+	node, err := basemodule.NewServerSession(a, "test", &registry.Node{Id: "test@n2", Address: servers[1].Addr()})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	defer node.GetRPC().Done()
+	if result, err := node.CallE(ctx, "whoami"); err != nil || result != "n2" {
+		t.Fatalf("Expected n2, got %v %v", result, err)
+	}
+}
+
+func TestQueueGroupControl(t *testing.T) {
+	a := app.NewApp(module.Transport(memory.NewTransport()), module.QueueGroup(true))
+	canceled := make(chan string, 10)
+	for _, id := range []string{"n1", "n2"} {
+		id := id
+		server, err := defaultrpc.NewRPCServerWithID(a, &testModule{app: a}, id)
+		if err != nil {
+			t.Fatalf("Unexpected error creating rpc server: %v", err)
+		}
+		defer server.Done()
+		server.RegisterGO("count", func(n int64, stream mqrpc.Stream) error {
+			for i := int64(0); i < n; i++ {
+				if err := stream.Send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		server.RegisterGO("tail", func(stream mqrpc.Stream) error {
+			for i := int64(0); ; i++ {
+				if err := stream.Send(i); err != nil {
+					canceled <- id
+					return err
+				}
+			}
+		})
+	}
+	session, err := a.GetQueueServer("test")
+	if err != nil {
+		t.Fatalf("Unexpected error creating queue session: %v", err)
+	}
+	defer session.GetRPC().Done()
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	// 超过窗口大小,确认消息必须发送到处理请求的节点
+	for round := 0; round < 4; round++ {
+		stream, err := session.CallStream(ctx, "count", int64(100))
+		if err != nil {
+			t.Fatalf("Unexpected error calling count: %v", err)
+		}
+		for i := int64(0); i < 100; i++ {
+			var v int64
+			if err := stream.Recv(&v); err != nil || v != i {
+				t.Fatalf("round %d: Expected %d, got %d %v", round, i, v, err)
+			}
+		}
+		if err := stream.Recv(nil); err != io.EOF {
+			t.Fatalf("round %d: Expected io.EOF, got %v", round, err)
+		}
+	}
+	// 取消消息同样发送到处理请求的节点
+	for round := 0; round < 4; round++ {
+		stream, err := session.CallStream(ctx, "tail")
+		if err != nil {
+			t.Fatalf("Unexpected error calling tail: %v", err)
+		}
+		if err := stream.Recv(nil); err != nil {
+			t.Fatalf("round %d: Unexpected error receiving: %v", round, err)
+		}
+		stream.Close()
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatalf("round %d: Expected the serving node to be canceled", round)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/registry/mock"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/selector"
+	"github.com/liangdas/mqant/selector/cache"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+type markSelector struct {
+	selector.Selector
+	lock  sync.Mutex
+	marks []string
+}
+
+func (s *markSelector) Mark(service string, node *registry.Node, err error) {
+	s.lock.Lock()
+	s.marks = append(s.marks, fmt.Sprintf("%s=%v", node.Id, err == nil))
+	s.lock.Unlock()
+}
+
+func (s *markSelector) takeMarks() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	marks := s.marks
+	s.marks = nil
+	return marks
+}
+
+func TestRetry(t *testing.T) {
+	reg := mock.NewRegistry()
+	sel := &markSelector{Selector: cache.NewSelector()}
+	a := app.NewApp(
+		module.Transport(memory.NewTransport()),
+		module.Selector(sel),
+		module.Registry(reg),
+		module.RPCExpired(100*time.Millisecond),
+		module.Retry(module.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     10 * time.Millisecond,
+			Idempotent:  module.IdempotentFuncs("retry/who"),
+		}),
+	)
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	defer server.Done()
+	server.Register("who", func() (string, error) {
+		return "retry@1", nil
+	})
+	server.Register("once", func() (string, error) {
+		return "retry@1", nil
+	})
+	reg.Register(&registry.Service{Name: "retry", Version: "1.0.0", Nodes: []*registry.Node{
+		// 没有服务监听这个地址,请求会超时
+		{Id: "retry@dead", Address: "nowhere"},
+		{Id: "retry@1", Address: server.Addr()},
+	}})
+	// 等待订阅完成
+	time.Sleep(time.Millisecond * 50)
+	inOrder := selector.WithStrategy(func(services []*registry.Service) selector.Next {
+		i := 0
+		return func() (*registry.Node, error) {
+			node := services[0].Nodes[i%len(services[0].Nodes)]
+			i++
+			return node, nil
+		}
+	})
+
+	result, err := a.CallE(context.TODO(), "retry", "who", mqrpc.Param(), inOrder)
+	if err != nil || result != "retry@1" {
+		t.Fatalf("Expected retry@1 after retry, got %v %v", result, err)
+	}
+	if marks := sel.takeMarks(); fmt.Sprint(marks) != "[retry@dead=false retry@1=true]" {
+		t.Fatalf("Unexpected marks %v", marks)
+	}
+
+	// 非幂等函数超时后不重试
+	_, err = a.CallE(context.TODO(), "retry", "once", mqrpc.Param(), inOrder)
+	if mqrpc.ErrorCode(err) != mqrpc.CodeDeadlineExceeded {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if marks := sel.takeMarks(); fmt.Sprint(marks) != "[retry@dead=false]" {
+		t.Fatalf("Unexpected marks %v", marks)
+	}
+}
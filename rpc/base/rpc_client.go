@@ -22,14 +22,16 @@ import (
 	"github.com/liangdas/mqant/rpc"
 	"github.com/liangdas/mqant/rpc/pb"
 	"github.com/liangdas/mqant/rpc/util"
+	"github.com/liangdas/mqant/tracing"
 	"github.com/liangdas/mqant/utils/uuid"
 	"os"
 	"time"
 )
 
 type RPCClient struct {
-	app         module.App
-	nats_client *NatsClient
+	app          module.App
+	nats_client  *NatsClient
+	local_client *LocalClient
 }
 
 func NewRPCClient(app module.App, session module.ServerSession) (mqrpc.RPCClient, error) {
@@ -41,17 +43,72 @@ func NewRPCClient(app module.App, session module.ServerSession) (mqrpc.RPCClient
 		return nil, err
 	}
 	rpc_client.nats_client = nats_client
+	local_client, err := NewLocalClient(app, session)
+	if err != nil {
+		log.Error("Dial: %s", err)
+		return nil, err
+	}
+	rpc_client.local_client = local_client
 	return rpc_client, nil
 }
 
 func (c *RPCClient) Done() (err error) {
+	if c.local_client != nil {
+		err = c.local_client.Done()
+	}
 	if c.nats_client != nil {
 		err = c.nats_client.Done()
 	}
 	return
 }
 
-func (c *RPCClient) CallArgs(ctx context.Context, _func string, ArgsType []string, args [][]byte) (r interface{}, e string) {
+/**
+消息请求 需要回复,错误以字符串返回
+*/
+func (c *RPCClient) CallArgs(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, string) {
+	r, err := c.callArgs(ctx, _func, ArgsType, args)
+	if err != nil {
+		return r, err.Error()
+	}
+	return r, ""
+}
+
+/**
+消息请求 需要回复,错误以*mqrpc.Error返回,可以通过错误码判断错误类型
+*/
+func (c *RPCClient) CallArgsE(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, error) {
+	r, err := c.callArgs(ctx, _func, ArgsType, args)
+	if err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+/**
+客户端产生的错误,节点标记为本次调用的目标节点
+*/
+func (c *RPCClient) newError(code int32, format string, a ...interface{}) *mqrpc.Error {
+	e := mqrpc.NewError(code, format, a...)
+	e.Node = c.nats_client.session.GetID()
+	return e
+}
+
+func (c *RPCClient) callArgs(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, *mqrpc.Error) {
+	ctx, cancel, callInfo, end := c.begin(ctx, _func, ArgsType, args)
+	defer cancel()
+	result, err := c.invoker()(ctx, callInfo)
+	//拦截器直接返回的普通error视为拒绝了本次调用
+	e := mqrpc.WrapError(mqrpc.CodeRejected, err)
+	end(result, e)
+	return result, e
+}
+
+/**
+创建一次需要回复的调用
+ctx没有超时时间时使用RPCExpired,返回的cancel在调用结束后调用
+返回的end在收到结果后调用,记录调用方监控、指标与span
+*/
+func (c *RPCClient) begin(ctx context.Context, _func string, ArgsType []string, args [][]byte) (context.Context, context.CancelFunc, *mqrpc.CallInfo, func(r interface{}, e *mqrpc.Error)) {
 	caller, _ := os.Hostname()
 	if ctx != nil {
 		cr, ok := ctx.Value("caller").(string)
@@ -60,54 +117,133 @@ func (c *RPCClient) CallArgs(ctx context.Context, _func string, ArgsType []strin
 		}
 	}
 	start := time.Now()
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	cancel := context.CancelFunc(func() {})
+	//ctx带有超时时间时沿用剩余的时间,例如在handler中使用收到的ctx继续调用其他服务
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = start.Add(c.app.Options().RPCExpired)
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
 	var correlation_id = uuid.Rand().Hex()
 	rpcInfo := &rpcpb.RPCInfo{
 		Fn:       *proto.String(_func),
 		Reply:    *proto.Bool(true),
-		Expired:  *proto.Int64((start.UTC().Add(c.app.Options().RPCExpired).UnixNano()) / 1000000),
+		Expired:  *proto.Int64(deadline.UnixNano() / 1000000),
 		Cid:      *proto.String(correlation_id),
 		Args:     args,
 		ArgsType: ArgsType,
 		Caller:   *proto.String(caller),
 		Hostname: *proto.String(caller),
 	}
-	defer func() {
+	session := c.nats_client.session
+	ctx, span := c.app.Options().Tracer.Start(ctx, session.GetName()+"/"+_func, tracing.SpanKindClient)
+	if span != nil {
+		span.SetAttribute("rpc.service", session.GetName())
+		span.SetAttribute("rpc.method", _func)
+		span.SetAttribute("rpc.node", session.GetID())
+	}
+	if md := mqrpc.MetadataFromContext(ctx); len(md) > 0 || span != nil {
+		rpcInfo.Metadata = make(map[string]string, len(md)+1)
+		for k, v := range md {
+			rpcInfo.Metadata[k] = v
+		}
+		//调用方的span作为服务端span的父span
+		tracing.Inject(span.SpanContext(), rpcInfo.Metadata)
+	}
+	callInfo := &mqrpc.CallInfo{
+		RPCInfo: rpcInfo,
+	}
+	var metricsDone func(code int32)
+	if m := c.app.Options().Metrics; m != nil {
+		metricsDone = m.ClientBegin(session.GetName(), session.GetID(), _func)
+	}
+	end := func(r interface{}, e *mqrpc.Error) {
+		if metricsDone != nil {
+			code := mqrpc.CodeOK
+			if e != nil {
+				code = e.Code
+			}
+			metricsDone(code)
+		}
 		//异常日志都应该打印
 		if c.app.Options().ClientRPChandler != nil {
 			exec_time := time.Since(start).Nanoseconds()
-			c.app.Options().ClientRPChandler(c.app, *c.nats_client.session.GetNode(), rpcInfo, r, e, exec_time)
+			errstr := ""
+			if e != nil {
+				errstr = e.Error()
+			}
+			c.app.Options().ClientRPChandler(c.app, *c.nats_client.session.GetNode(), callInfo.RPCInfo, r, errstr, exec_time)
+		}
+		if span != nil {
+			if e != nil {
+				span.SetError(e)
+			}
+			span.End()
 		}
-	}()
-	callInfo := &mqrpc.CallInfo{
-		RPCInfo: rpcInfo,
 	}
+	return ctx, cancel, callInfo, end
+}
+
+/**
+按照配置的客户端拦截器包装invoke
+*/
+func (c *RPCClient) invoker() mqrpc.ClientInvoker {
+	return mqrpc.ChainClientInterceptors(c.app.Options().ClientInterceptors, c.invoke)
+}
+
+/**
+实际发出请求,位于拦截器链的最内层
+*/
+func (c *RPCClient) invoke(ctx context.Context, callInfo *mqrpc.CallInfo) (interface{}, error) {
+	var r interface{}
+	var e *mqrpc.Error
+	if callInfo.RPCInfo.Reply {
+		r, e = c.doCall(ctx, callInfo)
+	} else {
+		e = c.doCallNR(ctx, callInfo)
+	}
+	if e != nil {
+		return r, e
+	}
+	return r, nil
+}
+
+func (c *RPCClient) doCall(ctx context.Context, callInfo *mqrpc.CallInfo) (interface{}, *mqrpc.Error) {
+	rpcInfo := callInfo.RPCInfo
 	callback := make(chan *rpcpb.ResultInfo, 1)
 	var err error
 	//优先使用本地rpc
-	//if c.local_client != nil {
-	//	err = c.local_client.Call(*callInfo, callback)
-	//} else
-	err = c.nats_client.Call(callInfo, callback)
-	if err != nil {
-		return nil, err.Error()
+	if c.local_client.IsLocal() {
+		err = c.local_client.Call(ctx, callInfo, callback)
+	} else {
+		err = c.nats_client.Call(callInfo, callback)
 	}
-	if ctx == nil {
-		ctx, _ = context.WithTimeout(context.TODO(), c.app.Options().RPCExpired)
+	if err != nil {
+		return nil, c.sendError(err)
 	}
 	select {
 	case resultInfo, ok := <-callback:
 		if !ok {
-			return nil, "client closed"
+			return nil, c.newError(mqrpc.CodeUnavailable, "client closed")
 		}
 		result, err := argsutil.Bytes2Args(c.app, resultInfo.ResultType, resultInfo.Result)
 		if err != nil {
-			return nil, err.Error()
+			return nil, c.newError(mqrpc.CodeInternal, "%s", err.Error())
 		}
-		return result, resultInfo.Error
+		return result, mqrpc.ResultError(resultInfo)
 	case <-ctx.Done():
 		c.close_callback_chan(callback)
 		c.nats_client.Delete(rpcInfo.Cid)
-		return nil, "deadline exceeded"
+		c.local_client.Delete(rpcInfo.Cid)
+		//通知服务端取消正在执行的handler,不再等待它的应答
+		c.sendControl(rpcInfo, "", mqrpc.ControlCancel, 0)
+		if ctx.Err() == context.Canceled {
+			return nil, c.newError(mqrpc.CodeCanceled, "context canceled")
+		}
+		return nil, c.newError(mqrpc.CodeDeadlineExceeded, "deadline exceeded")
 		//case <-time.After(time.Second * time.Duration(c.app.GetSettings().rpc.RPCExpired)):
 		//	close(callback)
 		//	c.nats_client.Delete(rpcInfo.Cid)
@@ -139,17 +275,110 @@ func (c *RPCClient) CallNRArgs(_func string, ArgsType []string, args [][]byte) (
 	callInfo := &mqrpc.CallInfo{
 		RPCInfo: rpcInfo,
 	}
+	//进程内投递时服务端队列已满最多等待到请求过期
+	ctx, cancel := context.WithDeadline(context.TODO(), time.Unix(0, rpcInfo.Expired*int64(time.Millisecond)))
+	defer cancel()
+	_, err = c.invoker()(ctx, callInfo)
+	return err
+}
+
+func (c *RPCClient) doCallNR(ctx context.Context, callInfo *mqrpc.CallInfo) *mqrpc.Error {
+	var err error
 	//优先使用本地rpc
-	//if c.local_client != nil {
-	//	err = c.local_client.CallNR(*callInfo)
-	//} else
-	return c.nats_client.CallNR(callInfo)
+	if c.local_client.IsLocal() {
+		err = c.local_client.CallNR(ctx, callInfo)
+	} else {
+		err = c.nats_client.CallNR(callInfo)
+	}
+	if err != nil {
+		return c.sendError(err)
+	}
+	return nil
+}
+
+/**
+请求没有发送出去
+进程内投递时等待服务端队列超过了ctx的期限,与等待应答超时一样返回
+*/
+func (c *RPCClient) sendError(err error) *mqrpc.Error {
+	switch err {
+	case context.DeadlineExceeded:
+		return c.newError(mqrpc.CodeDeadlineExceeded, "deadline exceeded")
+	case context.Canceled:
+		return c.newError(mqrpc.CodeCanceled, "context canceled")
+	}
+	ce := c.newError(mqrpc.CodeUnavailable, "%s", err.Error())
+	ce.Retryable = true
+	return ce
 }
 
 /**
 消息请求 需要回复
 */
 func (c *RPCClient) Call(ctx context.Context, _func string, params ...interface{}) (interface{}, string) {
+	r, err := c.call(ctx, _func, params...)
+	if err != nil {
+		return r, err.Error()
+	}
+	return r, ""
+}
+
+/**
+消息请求 需要回复,错误以*mqrpc.Error返回
+*/
+func (c *RPCClient) CallE(ctx context.Context, _func string, params ...interface{}) (interface{}, error) {
+	r, err := c.call(ctx, _func, params...)
+	if err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+/**
+消息请求 需要回复,调用成功后将结果解码到out中,out必须是指针
+*/
+func (c *RPCClient) CallInto(ctx context.Context, _func string, out interface{}, params ...interface{}) error {
+	r, err := c.call(ctx, _func, params...)
+	if err != nil {
+		return err
+	}
+	if e := mqrpc.Assign(out, r); e != nil {
+		return c.newError(mqrpc.CodeInternal, "%s", e.Error())
+	}
+	return nil
+}
+
+/**
+消息请求 需要回复,立即返回Future,在新的goroutine中等待结果
+参数在返回前已经完成编码,之后修改参数不会影响这次调用
+*/
+func (c *RPCClient) CallAsync(ctx context.Context, _func string, params ...interface{}) *mqrpc.Future {
+	future := mqrpc.NewFuture()
+	ArgsType, args, span, e := c.encodeParams(params)
+	if e != nil {
+		future.Complete(nil, e)
+		return future
+	}
+	go func() {
+		r, e := c.callEncoded(ctx, _func, ArgsType, args, span)
+		if e != nil {
+			future.Complete(r, e)
+			return
+		}
+		future.Complete(r, nil)
+	}()
+	return future
+}
+
+func (c *RPCClient) call(ctx context.Context, _func string, params ...interface{}) (interface{}, *mqrpc.Error) {
+	ArgsType, args, span, e := c.encodeParams(params)
+	if e != nil {
+		return nil, e
+	}
+	return c.callEncoded(ctx, _func, ArgsType, args, span)
+}
+
+func (c *RPCClient) encodeParams(params []interface{}) ([]string, [][]byte, log.TraceSpan, *mqrpc.Error) {
 	var ArgsType []string = make([]string, len(params))
 	var args [][]byte = make([][]byte, len(params))
 	var span log.TraceSpan = nil
@@ -157,7 +386,7 @@ func (c *RPCClient) Call(ctx context.Context, _func string, params ...interface{
 		var err error = nil
 		ArgsType[k], args[k], err = argsutil.ArgsTypeAnd2Bytes(c.app, param)
 		if err != nil {
-			return nil, fmt.Sprintf("args[%d] error %s", k, err.Error())
+			return nil, nil, nil, c.newError(mqrpc.CodeInvalidArgument, "args[%d] error %s", k, err.Error())
 		}
 		switch v2 := param.(type) { //多选语句switch
 		case log.TraceSpan:
@@ -165,12 +394,112 @@ func (c *RPCClient) Call(ctx context.Context, _func string, params ...interface{
 			span = v2
 		}
 	}
+	return ArgsType, args, span, nil
+}
+
+func (c *RPCClient) callEncoded(ctx context.Context, _func string, ArgsType []string, args [][]byte, span log.TraceSpan) (interface{}, *mqrpc.Error) {
 	start := time.Now()
-	r, errstr := c.CallArgs(ctx, _func, ArgsType, args)
+	r, e := c.callArgs(ctx, _func, ArgsType, args)
 	if c.app.GetSettings().RPC.Log {
-		log.TInfo(span, "rpc Call ServerId = %v Func = %v Elapsed = %v Result = %v ERROR = %v", c.nats_client.session.GetID(), _func, time.Since(start), r, errstr)
+		log.TInfo(span, "rpc Call ServerId = %v Func = %v Elapsed = %v Result = %v ERROR = %v", c.nats_client.session.GetID(), _func, time.Since(start), r, e)
+	}
+	return r, e
+}
+
+/**
+流式请求,服务端handler的最后一个参数为mqrpc.Stream
+ctx带有超时时间时整个流受该时间限制,否则与Call一样受RPCExpired限制
+与Call一样经过客户端拦截器,流结束时记录调用方监控、指标与span
+*/
+func (c *RPCClient) CallStream(ctx context.Context, _func string, params ...interface{}) (mqrpc.Stream, error) {
+	ArgsType, args, _, e := c.encodeParams(params)
+	if e != nil {
+		return nil, e
+	}
+	ctx, cancel, callInfo, end := c.begin(ctx, _func, ArgsType, args)
+	window := mqrpc.DefaultStreamWindow
+	callInfo.RPCInfo.Stream = true
+	callInfo.RPCInfo.Window = int32(window)
+	//服务端最多发送window条未确认的消息,再加上结束标记
+	results := make(chan *rpcpb.ResultInfo, window+1)
+	invoker := mqrpc.ChainClientInterceptors(c.app.Options().ClientInterceptors, func(ctx context.Context, callInfo *mqrpc.CallInfo) (interface{}, error) {
+		if e := c.openStream(ctx, callInfo, results); e != nil {
+			return nil, e
+		}
+		return nil, nil
+	})
+	if _, err := invoker(ctx, callInfo); err != nil {
+		e := mqrpc.WrapError(mqrpc.CodeRejected, err)
+		end(nil, e)
+		cancel()
+		return nil, e
+	}
+	ctx, streamCancel := context.WithCancel(ctx)
+	stream := &clientStream{
+		client: c,
+		ctx:    ctx,
+		cancel: func() {
+			streamCancel()
+			cancel()
+		},
+		end: end,
+		request: &streamRequest{
+			service: c.nats_client.session.GetName(),
+			method:  _func,
+			args:    params,
+		},
+		rpcInfo: callInfo.RPCInfo,
+		results: results,
+		window:  window,
+	}
+	go stream.watch()
+	return stream, nil
+}
+
+/**
+发出流式请求,位于拦截器链的最内层
+*/
+func (c *RPCClient) openStream(ctx context.Context, callInfo *mqrpc.CallInfo, results chan *rpcpb.ResultInfo) *mqrpc.Error {
+	var err error
+	if c.local_client.IsLocal() {
+		err = c.local_client.Call(ctx, callInfo, results)
+	} else {
+		err = c.nats_client.Call(callInfo, results)
+	}
+	if err != nil {
+		return c.sendError(err)
+	}
+	return nil
+}
+
+/**
+发送调用的控制消息(取消、流确认)
+Fn留空,不识别控制消息的旧版本服务端只会找不到handler,不会再次执行原来的函数
+通过队列组地址调用时发送到处理请求的节点node(ResultInfo.Node)
+*/
+func (c *RPCClient) sendControl(rpcInfo *rpcpb.RPCInfo, node string, control int32, window int32) {
+	queue := c.nats_client.isQueue()
+	if queue && node == "" {
+		//队列组地址会把控制消息投递给任意一个节点,还不知道处理请求的节点时不发送
+		return
+	}
+	callInfo := &mqrpc.CallInfo{
+		RPCInfo: &rpcpb.RPCInfo{
+			Cid:     rpcInfo.Cid,
+			Expired: rpcInfo.Expired,
+			Control: control,
+			Window:  window,
+		},
+	}
+	var err error
+	if queue {
+		err = c.nats_client.CallNRTo(node, callInfo)
+	} else if e := c.doCallNR(context.TODO(), callInfo); e != nil {
+		err = e
+	}
+	if err != nil {
+		log.Warning("rpc send control %v error %v", control, err)
 	}
-	return r, errstr
 }
 
 /**
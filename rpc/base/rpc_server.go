@@ -14,6 +14,7 @@
 package defaultrpc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/golang/protobuf/proto"
@@ -22,40 +23,70 @@ import (
 	"github.com/liangdas/mqant/rpc"
 	"github.com/liangdas/mqant/rpc/pb"
 	"github.com/liangdas/mqant/rpc/util"
+	"github.com/liangdas/mqant/tracing"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 type RPCServer struct {
+	executing      int64 //正在执行的handler数量,原子操作,放在首位保证64位对齐
 	module         module.Module
 	app            module.App
+	id             string //节点ID,开启队列组时用于生成节点地址
 	functions      map[string]*mqrpc.FunctionInfo
+	functionsLock  sync.RWMutex
 	nats_server    *NatsServer
-	mq_chan        chan mqrpc.CallInfo //接收到请求信息的队列
-	wg             sync.WaitGroup      //任务阻塞
-	call_chan_done chan error
+	local_server   *LocalServer
+	mq_chan        chan *mqrpc.CallInfo //接收到请求信息的队列,nats与进程内的请求都由同一个协程依次处理
+	wg             sync.WaitGroup       //任务阻塞
+	call_chan_done chan bool            //处理请求的协程已经退出
+	done           chan bool            //停止处理请求
 	listener       mqrpc.RPCListener
-	control        mqrpc.GoroutineControl //控制模块可同时开启的最大协程数
-	executing      int64                  //正在执行的goroutine数量
+	control        mqrpc.GoroutineControl   //控制模块可同时开启的最大协程数
+	middlewares    []mqrpc.ServerMiddleware //对所有handler生效的中间件
+	streams        sync.Map                 //正在执行的流式调用 Cid -> *serverStream
+	running        sync.Map                 //正在执行的普通调用以及还没开始执行就被取消的调用 Cid -> *runningCall
+	sweepLock      sync.Mutex               //保护lastSweep
+	lastSweep      time.Time                //上一次清理过期取消记录的时间
+	idempotency    *idempotencyCache        //幂等handler最近的应答
+	drainLock      sync.RWMutex
+	draining       bool //下线中,不再接收新的请求
 }
 
 func NewRPCServer(app module.App, module module.Module) (mqrpc.RPCServer, error) {
+	return NewRPCServerWithID(app, module, "")
+}
+
+/**
+创建RPC服务,app开启QueueGroup且id不为空时
+节点地址为 mqant.<type>.<id>,并以队列组方式订阅模块地址 mqant.<type>
+*/
+func NewRPCServerWithID(app module.App, module module.Module, id string) (mqrpc.RPCServer, error) {
 	rpc_server := new(RPCServer)
 	rpc_server.app = app
 	rpc_server.module = module
-	rpc_server.call_chan_done = make(chan error)
+	rpc_server.id = id
+	rpc_server.call_chan_done = make(chan bool)
+	rpc_server.done = make(chan bool)
 	rpc_server.functions = make(map[string]*mqrpc.FunctionInfo)
-	rpc_server.mq_chan = make(chan mqrpc.CallInfo)
+	rpc_server.mq_chan = make(chan *mqrpc.CallInfo, CallQueueSize)
+	rpc_server.idempotency = newIdempotencyCache()
+	//先启动处理协程再开始接收请求
+	go rpc_server.on_call_handle()
 
 	nats_server, err := NewNatsServer(app, rpc_server)
 	if err != nil {
 		log.Error("AMQPServer Dial: %s", err)
 	}
 	rpc_server.nats_server = nats_server
-
-	//go rpc_server.on_call_handle(rpc_server.mq_chan, rpc_server.call_chan_done)
+	//同进程内的调用方可以直接投递到local_server
+	rpc_server.local_server = NewLocalServer(nats_server.Addr(), rpc_server)
 
 	return rpc_server, nil
 }
@@ -72,22 +103,46 @@ func (s *RPCServer) SetGoroutineControl(control mqrpc.GoroutineControl) {
 }
 
 /**
-获取当前正在执行的goroutine 数量
+获取当前正在执行的handler数量
 */
 func (s *RPCServer) GetExecuting() int64 {
-	return s.executing
+	return atomic.LoadInt64(&s.executing)
+}
+
+/**
+添加对所有handler生效的中间件,先添加的位于外层
+需要在开始处理请求之前调用
+*/
+func (s *RPCServer) Use(middlewares ...mqrpc.ServerMiddleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
 }
 
 // you must call the function before calling Open and Go
-func (s *RPCServer) Register(id string, f interface{}) {
+// middlewares 只对该handler生效,位于Use添加的中间件内层
+// f 的签名不合法时会panic
+func (s *RPCServer) Register(id string, f interface{}, middlewares ...mqrpc.ServerMiddleware) {
+	s.register(id, f, false, middlewares)
+}
+
+// you must call the function before calling Open and Go
+func (s *RPCServer) RegisterGO(id string, f interface{}, middlewares ...mqrpc.ServerMiddleware) {
+	s.register(id, f, true, middlewares)
+}
 
+func (s *RPCServer) register(id string, f interface{}, goroutine bool, middlewares []mqrpc.ServerMiddleware) {
+	s.functionsLock.Lock()
+	defer s.functionsLock.Unlock()
 	if _, ok := s.functions[id]; ok {
 		panic(fmt.Sprintf("function id %v: already registered", id))
 	}
+	if err := s.checkFunction(f); err != nil {
+		panic(fmt.Sprintf("%s rpc func(%s) %v", s.module.GetType(), id, err))
+	}
 	finfo := &mqrpc.FunctionInfo{
-		Function:  reflect.ValueOf(f),
-		FuncType:  reflect.ValueOf(f).Type(),
-		Goroutine: false,
+		Function:    reflect.ValueOf(f),
+		FuncType:    reflect.ValueOf(f).Type(),
+		Goroutine:   goroutine,
+		Middlewares: middlewares,
 	}
 
 	finfo.InType = []reflect.Type{}
@@ -95,82 +150,341 @@ func (s *RPCServer) Register(id string, f interface{}) {
 		rv := finfo.FuncType.In(i)
 		finfo.InType = append(finfo.InType, rv)
 	}
+	//第一个参数为context.Context时由服务端传入,调用方不需要传递
+	finfo.Context = len(finfo.InType) > 0 && finfo.InType[0] == contextType
+	//最后一个参数为mqrpc.Stream时为流式handler
+	finfo.Stream = len(finfo.InType) > 0 && finfo.InType[len(finfo.InType)-1] == streamType
+	if finfo.Stream {
+		//流式handler需要在执行期间处理调用方的确认消息,不能阻塞串行队列
+		finfo.Goroutine = true
+	}
 	s.functions[id] = finfo
-
 }
 
-// you must call the function before calling Open and Go
-func (s *RPCServer) RegisterGO(id string, f interface{}) {
-
-	if _, ok := s.functions[id]; ok {
-		panic(fmt.Sprintf("function id %v: already registered", id))
+/**
+已注册的handler
+*/
+func (s *RPCServer) Functions() map[string]*mqrpc.FunctionInfo {
+	s.functionsLock.RLock()
+	defer s.functionsLock.RUnlock()
+	functions := make(map[string]*mqrpc.FunctionInfo, len(s.functions))
+	for id, finfo := range s.functions {
+		functions[id] = finfo
 	}
+	return functions
+}
 
-	finfo := &mqrpc.FunctionInfo{
-		Function:  reflect.ValueOf(f),
-		FuncType:  reflect.ValueOf(f).Type(),
-		Goroutine: true,
-	}
+/**
+进入下线状态,之后收到的请求直接以可以重试的CodeUnavailable拒绝,调用方可以换一个节点重试
+已经在执行和排队的请求继续处理
+*/
+func (s *RPCServer) Drain() {
+	s.drainLock.Lock()
+	s.draining = true
+	s.drainLock.Unlock()
+}
 
-	finfo.InType = []reflect.Type{}
-	for i := 0; i < finfo.FuncType.NumIn(); i++ {
-		rv := finfo.FuncType.In(i)
-		finfo.InType = append(finfo.InType, rv)
+/**
+开启队列组时的节点地址,随应答返回给调用方
+*/
+func (s *RPCServer) nodeAddr() string {
+	if s.nats_server == nil {
+		return ""
 	}
-	s.functions[id] = finfo
+	return s.nats_server.nodeAddr()
+}
+
+func (s *RPCServer) isDraining() bool {
+	s.drainLock.RLock()
+	defer s.drainLock.RUnlock()
+	return s.draining
 }
 
 func (s *RPCServer) Done() (err error) {
-	//等待正在执行的请求完成
-	//close(s.mq_chan)   //关闭mq_chan通道
-	//<-s.call_chan_done //mq_chan通道的信息都已处理完
+	//不再接收新的请求,保证wg.Wait之后没有新的任务
+	s.Drain()
+	//先注销进程内服务,同进程的调用方后续会走nats
+	if s.local_server != nil {
+		err = s.local_server.Shutdown()
+	}
+	//等待正在执行的请求完成,期间依然接收流确认与取消消息
 	s.wg.Wait()
-	//s.call_chan_done <- nil
 	//关闭队列链接
 	if s.nats_server != nil {
 		err = s.nats_server.Shutdown()
 	}
+	//不会再有新的请求,处理完已经排队的请求后退出
+	safeClose(s.done)
+	<-s.call_chan_done
 	return
 }
 
+// CallQueueSize 等待处理的请求队列长度,队列已满时接收请求的协程阻塞
+var CallQueueSize = 1024
+
+/**
+接收请求
+控制消息在接收协程中立即处理,不需要等待前面的请求,
+其他请求放入队列由处理协程依次执行,Register注册的handler因此保持串行
+*/
 func (s *RPCServer) Call(callInfo *mqrpc.CallInfo) error {
+	return s.call(context.Background(), callInfo)
+}
+
+/**
+接收请求,队列已满时最多等待到ctx结束
+*/
+func (s *RPCServer) call(ctx context.Context, callInfo *mqrpc.CallInfo) error {
+	if callInfo.RPCInfo.Control != mqrpc.ControlNone {
+		s.onControl(callInfo)
+		return nil
+	}
+	select {
+	case s.mq_chan <- callInfo:
+		return nil
+	case <-s.done:
+		return fmt.Errorf("RPCServer is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/**
+依次处理队列中的请求
+*/
+func (s *RPCServer) on_call_handle() {
+	defer close(s.call_chan_done)
+	for {
+		select {
+		case callInfo := <-s.mq_chan:
+			s.handle(callInfo)
+		case <-s.done:
+			//已经在下线中,剩余的请求以可以重试的错误拒绝
+			for {
+				select {
+				case callInfo := <-s.mq_chan:
+					s.handle(callInfo)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *RPCServer) handle(callInfo *mqrpc.CallInfo) {
+	if s.isExpired(callInfo) {
+		//请求超时了,调用方已经放弃等待,无需再处理
+		s.onTimeOut(callInfo)
+		return
+	}
+	if s.isDraining() {
+		s.refuse(time.Now(), callInfo, s.drainingError(callInfo))
+		return
+	}
 	s.runFunc(callInfo)
-	//if callInfo.RPCInfo.Expired < (time.Now().UnixNano() / 1000000) {
-	//	//请求超时了,无需再处理
-	//	if s.listener != nil {
-	//		s.listener.OnTimeOut(callInfo.RPCInfo.Fn, callInfo.RPCInfo.Expired)
-	//	} else {
-	//		log.Warning("timeout: This is Call", s.module.GetType(), callInfo.RPCInfo.Fn, callInfo.RPCInfo.Expired, time.Now().UnixNano()/1000000)
-	//	}
-	//} else {
-	//	s.runFunc(callInfo)
-	//	//go func() {
-	//	//	resultInfo := rpcpb.NewResultInfo(callInfo.RPCInfo.Cid, "", argsutil.STRING, []byte("success"))
-	//	//	callInfo.Result = *resultInfo
-	//	//	s.doCallback(callInfo)
-	//	//}()
-	//
-	//}
-	return nil
+}
+
+/**
+正在执行的普通调用
+handler开始执行前收到取消消息时先保存一条cancel为空的取消记录,
+记录在expires之后失效,handler开始前检查到该记录就不再执行
+*/
+type runningCall struct {
+	canceled int32 //调用方已经取消,原子操作
+	cancel   context.CancelFunc
+	expires  time.Time //取消记录的过期时间
+}
+
+// CanceledTTL 调用方没有设置超时时,handler开始前收到的取消记录保留的时间
+var CanceledTTL = time.Minute
+
+/**
+handler开始执行前收到了取消消息
+*/
+func (s *RPCServer) canceledBeforeStart(callInfo *mqrpc.CallInfo) bool {
+	v, ok := s.running.Load(callInfo.RPCInfo.Cid)
+	return ok && v.(*runningCall).cancel == nil
+}
+
+/**
+拒绝已经被调用方取消的请求,调用方不再等待所以不会回复
+*/
+func (s *RPCServer) refuseCanceled(start time.Time, callInfo *mqrpc.CallInfo) {
+	s.refuse(start, callInfo, mqrpc.NewError(mqrpc.CodeCanceled, "%s rpc func(%s) canceled before start", s.module.GetType(), callInfo.RPCInfo.Fn))
+	s.running.Delete(callInfo.RPCInfo.Cid)
+}
+
+/**
+保存handler开始前收到的取消记录,并清理已经过期的记录
+*/
+func (s *RPCServer) addCanceled(callInfo *mqrpc.CallInfo) (call *runningCall, loaded bool) {
+	now := time.Now()
+	expires := now.Add(CanceledTTL)
+	if expired := callInfo.RPCInfo.Expired; expired > 0 {
+		expires = time.Unix(0, expired*int64(time.Millisecond))
+	}
+	v, loaded := s.running.LoadOrStore(callInfo.RPCInfo.Cid, &runningCall{canceled: 1, expires: expires})
+	s.sweepLock.Lock()
+	sweep := now.Sub(s.lastSweep) > time.Second
+	if sweep {
+		s.lastSweep = now
+	}
+	s.sweepLock.Unlock()
+	if sweep {
+		s.running.Range(func(k, v interface{}) bool {
+			if c := v.(*runningCall); c.cancel == nil && now.After(c.expires) {
+				s.running.Delete(k)
+			}
+			return true
+		})
+	}
+	return v.(*runningCall), loaded
+}
+
+/**
+调用方是否已经发送取消消息放弃等待
+*/
+func (s *RPCServer) isCanceled(callInfo *mqrpc.CallInfo) bool {
+	v, ok := s.running.Load(callInfo.RPCInfo.Cid)
+	return ok && atomic.LoadInt32(&v.(*runningCall).canceled) == 1
+}
+
+/**
+处理调用方发来的控制消息
+*/
+func (s *RPCServer) onControl(callInfo *mqrpc.CallInfo) {
+	cid := callInfo.RPCInfo.Cid
+	switch callInfo.RPCInfo.Control {
+	case mqrpc.ControlAck:
+		if v, ok := s.streams.Load(cid); ok {
+			v.(*serverStream).ack(callInfo.RPCInfo.Window)
+		}
+	case mqrpc.ControlCancel:
+		//取消handler的ctx,handler还没有开始执行时保存取消记录
+		if v, ok := s.streams.Load(cid); ok {
+			v.(*serverStream).cancel()
+		} else if call, loaded := s.addCanceled(callInfo); loaded && call.cancel != nil {
+			atomic.StoreInt32(&call.canceled, 1)
+			call.cancel()
+		}
+	default:
+		log.Warning("rpc unknown control %v", callInfo.RPCInfo.Control)
+	}
+}
+
+/**
+创建handler使用的上下文
+携带调用方剩余的超时时间与请求元数据,handler返回后取消
+*/
+func (s *RPCServer) newContext(callInfo *mqrpc.CallInfo) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if md := callInfo.RPCInfo.GetMetadata(); len(md) > 0 {
+		ctx = mqrpc.WithMetadata(ctx, md)
+	}
+	if expired := callInfo.RPCInfo.Expired; expired > 0 {
+		return context.WithDeadline(ctx, time.Unix(0, expired*int64(time.Millisecond)))
+	}
+	return context.WithCancel(ctx)
+}
+
+/**
+请求是否已超过调用方设置的最后期限
+*/
+func (s *RPCServer) isExpired(callInfo *mqrpc.CallInfo) bool {
+	expired := callInfo.RPCInfo.Expired
+	return expired > 0 && expired < (time.Now().UnixNano()/1000000)
+}
+
+func (s *RPCServer) onTimeOut(callInfo *mqrpc.CallInfo) {
+	if s.listener != nil {
+		s.listener.OnTimeOut(callInfo.RPCInfo.Fn, callInfo.RPCInfo.Expired)
+	} else {
+		log.Warning("timeout: This is Call %v %v %v %v", s.module.GetType(), callInfo.RPCInfo.Fn, callInfo.RPCInfo.Expired, time.Now().UnixNano()/1000000)
+	}
+}
+
+/**
+创建handler的span,调用方在元数据中传递了traceparent时作为其子span
+*/
+func (s *RPCServer) startSpan(callInfo *mqrpc.CallInfo) *tracing.Span {
+	tracer := s.app.Options().Tracer
+	if tracer == nil {
+		return nil
+	}
+	ctx := context.Background()
+	if sc, ok := tracing.Extract(callInfo.RPCInfo.GetMetadata()); ok {
+		ctx = tracing.ContextWithRemoteSpan(ctx, sc)
+	}
+	_, span := tracer.Start(ctx, s.module.GetType()+"/"+callInfo.RPCInfo.Fn, tracing.SpanKindServer)
+	span.SetAttribute("rpc.service", s.module.GetType())
+	span.SetAttribute("rpc.method", callInfo.RPCInfo.Fn)
+	span.SetAttribute("rpc.node", s.nodeID())
+	return span
+}
+
+/**
+handler结束(包括panic)后以应答中的错误结束span
+*/
+func (s *RPCServer) endSpan(span *tracing.Span, callInfo *mqrpc.CallInfo) {
+	if span == nil {
+		return
+	}
+	if e := mqrpc.ResultError(callInfo.Result); e != nil {
+		span.SetError(e)
+	}
+	span.End()
+}
+
+/**
+当前节点的ID,用于标记错误产生的节点
+*/
+func (s *RPCServer) nodeID() string {
+	if m, ok := s.module.(interface {
+		GetServerID() string
+	}); ok {
+		return m.GetServerID()
+	}
+	return s.Addr()
+}
+
+/**
+转换为应答中的错误信息,未指定节点时填充为当前节点
+handler返回的错误可能是共享的变量,这里不修改原对象
+*/
+func (s *RPCServer) errorInfo(e *mqrpc.Error) *rpcpb.RPCError {
+	pe := e.ToPB()
+	if pe.Node == "" {
+		pe.Node = s.nodeID()
+	}
+	return pe
 }
 
 func (s *RPCServer) doCallback(callInfo *mqrpc.CallInfo) {
+	callInfo.Result.Node = s.nodeAddr()
+	if callInfo.IdempotencyKey != "" {
+		s.idempotency.complete(callInfo.IdempotencyKey, callInfo.Result)
+	}
+	if m := s.app.Options().Metrics; m != nil {
+		code := mqrpc.CodeOK
+		if e := mqrpc.ResultError(callInfo.Result); e != nil {
+			code = e.Code
+		}
+		m.ServerDone(s.module.GetType(), s.nodeID(), callInfo.RPCInfo.Fn, code, time.Duration(callInfo.ExecTime))
+	}
 	if callInfo.RPCInfo.Reply {
 		//需要回复的才回复
-		err := callInfo.Agent.(mqrpc.MQServer).Callback(callInfo)
-		if err != nil {
-			log.Warning("rpc callback erro :\n%s", err.Error())
+		if s.isExpired(callInfo) {
+			//调用方已经超时放弃等待,无需再回复
+			s.onTimeOut(callInfo)
+		} else if s.isCanceled(callInfo) {
+			//调用方已经取消,无需再回复
+		} else {
+			err := callInfo.Agent.(mqrpc.MQServer).Callback(callInfo)
+			if err != nil {
+				log.Warning("rpc callback erro :\n%s", err.Error())
+			}
 		}
-
-		//if callInfo.RPCInfo.Expired < (time.Now().UnixNano() / 1000000) {
-		//	//请求超时了,无需再处理
-		//	err := callInfo.Agent.(mqrpc.MQServer).Callback(callInfo)
-		//	if err != nil {
-		//		log.Warning("rpc callback erro :\n%s", err.Error())
-		//	}
-		//}else {
-		//	log.Warning("timeout: This is Call %s %s", s.module.GetType(), callInfo.RPCInfo.Fn)
-		//}
 	} else {
 		//对于不需要回复的消息,可以判断一下是否出现错误，打印一些警告
 		if callInfo.Result.Error != "" {
@@ -182,15 +496,17 @@ func (s *RPCServer) doCallback(callInfo *mqrpc.CallInfo) {
 	}
 }
 
-func (s *RPCServer) _errorCallback(start time.Time, callInfo *mqrpc.CallInfo, Cid string, Error string) {
+func (s *RPCServer) _errorCallback(start time.Time, callInfo *mqrpc.CallInfo, Cid string, Error *mqrpc.Error) {
 	//异常日志都应该打印
 	//log.TError(span, "rpc Exec ModuleType = %v Func = %v Elapsed = %v ERROR:\n%v", s.module.GetType(), callInfo.RPCInfo.Fn, time.Since(start), Error)
-	resultInfo := rpcpb.NewResultInfo(Cid, Error, argsutil.NULL, nil)
+	resultInfo := rpcpb.NewResultInfo(Cid, Error.Message, argsutil.NULL, nil)
+	resultInfo.ErrorInfo = s.errorInfo(Error)
+	resultInfo.EOS = callInfo.RPCInfo.Stream
 	callInfo.Result = resultInfo
 	callInfo.ExecTime = time.Since(start).Nanoseconds()
 	s.doCallback(callInfo)
 	if s.listener != nil {
-		s.listener.OnError(callInfo.RPCInfo.Fn, callInfo, fmt.Errorf(Error))
+		s.listener.OnError(callInfo.RPCInfo.Fn, callInfo, Error)
 	}
 }
 
@@ -200,20 +516,27 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 	fInType := functionInfo.InType
 	params := callInfo.RPCInfo.Args
 	ArgsType := callInfo.RPCInfo.ArgsType
-	if len(params) != fType.NumIn() {
+	argsOffset := 0
+	if functionInfo.Context {
+		argsOffset = 1
+	}
+	streamArgs := 0
+	if functionInfo.Stream {
+		streamArgs = 1
+	}
+	span := s.startSpan(callInfo)
+	defer s.endSpan(span, callInfo)
+	if functionInfo.Stream != callInfo.RPCInfo.Stream {
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.NewError(mqrpc.CodeInvalidArgument, "rpc func(%s) stream mismatch, use CallStream to call stream functions", callInfo.RPCInfo.Fn))
+		return
+	}
+	if len(params)+argsOffset+streamArgs != fType.NumIn() {
 		//因为在调研的 _func的时候还会额外传递一个回调函数 cb
-		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("The number of params %v is not adapted.%v", params, f.String()))
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.NewError(mqrpc.CodeInvalidArgument, "The number of params %v is not adapted.%v", params, f.String()))
 		return
 	}
 
-	s.wg.Add(1)
-	s.executing++
 	defer func() {
-		s.wg.Add(-1)
-		s.executing--
-		if s.control != nil {
-			s.control.Finish()
-		}
 		if r := recover(); r != nil {
 			var rn = ""
 			switch r.(type) {
@@ -228,10 +551,48 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 			errstr := string(buf[:l])
 			allError := fmt.Sprintf("%s rpc func(%s) error %s\n ----Stack----\n%s", s.module.GetType(), callInfo.RPCInfo.Fn, rn, errstr)
 			log.Error(allError)
-			s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, allError)
+			s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.NewError(mqrpc.CodeInternal, "%s", allError))
 		}
 	}()
 
+	if s.isExpired(callInfo) {
+		//排队等待执行期间已经超时
+		if callInfo.IdempotencyKey != "" {
+			s.idempotency.abort(callInfo.IdempotencyKey)
+		}
+		s.onTimeOut(callInfo)
+		return
+	}
+	ctx, cancel := s.newContext(callInfo)
+	defer cancel()
+	if span != nil {
+		//handler使用ctx发起的调用成为子span
+		ctx = tracing.ContextWithSpan(ctx, span)
+	}
+	callInfo.Context = ctx
+	var stream *serverStream
+	if functionInfo.Stream {
+		stream = newServerStream(s, callInfo, ctx, cancel)
+		s.streams.Store(callInfo.RPCInfo.Cid, stream)
+		defer func() {
+			stream.Close()
+			s.streams.Delete(callInfo.RPCInfo.Cid)
+		}()
+		//先登记再检查,登记之前收到的取消消息保存在取消记录中
+		if s.canceledBeforeStart(callInfo) {
+			s.refuseCanceled(start, callInfo)
+			return
+		}
+	} else if callInfo.RPCInfo.Reply {
+		//调用方放弃等待时会发送取消消息
+		if _, loaded := s.running.LoadOrStore(callInfo.RPCInfo.Cid, &runningCall{cancel: cancel}); loaded {
+			//排队期间调用方已经取消
+			s.refuseCanceled(start, callInfo)
+			return
+		}
+		defer s.running.Delete(callInfo.RPCInfo.Cid)
+	}
+
 	//t:=RandInt64(2,3)
 	//time.Sleep(time.Second*time.Duration(t))
 	// f 为函数地址
@@ -241,7 +602,7 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 		in = make([]reflect.Value, len(params))
 		input = make([]interface{}, len(params))
 		for k, v := range ArgsType {
-			rv := fInType[k]
+			rv := fInType[k+argsOffset]
 			var elemp reflect.Value
 			if rv.Kind() == reflect.Ptr {
 				//如果是指针类型就得取到指针所代表的具体类型
@@ -253,7 +614,7 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 			if pb, ok := elemp.Interface().(mqrpc.Marshaler); ok {
 				err := pb.Unmarshal(params[k])
 				if err != nil {
-					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
+					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeInvalidArgument, err))
 					return
 				}
 				if pb == nil { //多选语句switch
@@ -270,7 +631,7 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 			} else if pb, ok := elemp.Interface().(proto.Message); ok {
 				err := proto.Unmarshal(params[k], pb)
 				if err != nil {
-					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
+					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeInvalidArgument, err))
 					return
 				}
 				if pb == nil { //多选语句switch
@@ -284,11 +645,24 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 					in[k] = elemp.Elem()
 				}
 				input[k] = pb
+			} else if strings.HasPrefix(v, argsutil.JSON+"@") && rv.Kind() != reflect.Interface {
+				//json编码的结构体直接解码为参数类型
+				err := json.Unmarshal(params[k], elemp.Interface())
+				if err != nil {
+					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeInvalidArgument, err))
+					return
+				}
+				if rv.Kind() == reflect.Ptr {
+					in[k] = elemp
+				} else {
+					in[k] = elemp.Elem()
+				}
+				input[k] = in[k].Interface()
 			} else {
 				//不是Marshaler 才尝试用 argsutil 解析
 				ty, err := argsutil.Bytes2Args(s.app, v, params[k])
 				if err != nil {
-					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
+					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeInvalidArgument, err))
 					return
 				}
 				switch v2 := ty.(type) { //多选语句switch
@@ -309,7 +683,12 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 						}
 					}
 				default:
-					in[k] = reflect.ValueOf(ty)
+					tv := reflect.ValueOf(ty)
+					if !tv.Type().AssignableTo(rv) && isNumberKind(tv.Kind()) && isNumberKind(rv.Kind()) {
+						//数值类型之间直接转换,例如调用方传递int64,handler接收int
+						tv = tv.Convert(rv)
+					}
+					in[k] = tv
 				}
 				input[k] = in[k].Interface()
 			}
@@ -319,50 +698,89 @@ func (s *RPCServer) _runFunc(start time.Time, functionInfo *mqrpc.FunctionInfo,
 	if s.listener != nil {
 		errs := s.listener.BeforeHandle(callInfo.RPCInfo.Fn, callInfo)
 		if errs != nil {
-			s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, errs.Error())
+			s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeRejected, errs))
 			return
 		}
 	}
 
-	out := f.Call(in)
-	var rs []interface{}
-	if len(out) != 2 {
-		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("%s rpc func(%s) return error %s\n", s.module.GetType(), callInfo.RPCInfo.Fn, "func(....)(result interface{}, err error)"))
-		return
+	if functionInfo.Context {
+		in = append([]reflect.Value{reflect.ValueOf(ctx)}, in...)
+	}
+	if stream != nil {
+		stream.request.args = input
+		in = append(in, reflect.ValueOf(stream))
+	}
+	//中间件看到的是解码后的参数,可以替换参数后再交给下一层
+	margs := make([]interface{}, len(in))
+	for k, v := range in {
+		margs[k] = v.Interface()
 	}
-	if len(out) > 0 { //prepare out paras
-		rs = make([]interface{}, len(out), len(out))
-		for i, v := range out {
-			rs[i] = v.Interface()
+	handler := func(callInfo *mqrpc.CallInfo, args []interface{}) (interface{}, error) {
+		in := make([]reflect.Value, len(args))
+		for k, v := range args {
+			if v == nil {
+				in[k] = reflect.Zero(fInType[k])
+			} else {
+				in[k] = reflect.ValueOf(v)
+			}
+		}
+		out := f.Call(in)
+		var rs []interface{}
+		switch {
+		case functionInfo.Stream && len(out) == 1:
+			//流式handler只返回error
+			rs = []interface{}{nil, out[0].Interface()}
+		case len(out) == 2:
+			rs = []interface{}{out[0].Interface(), out[1].Interface()}
+		default:
+			return nil, mqrpc.NewError(mqrpc.CodeInternal, "%s rpc func(%s) return error %s\n", s.module.GetType(), callInfo.RPCInfo.Fn, "func(....)(result interface{}, err error)")
+		}
+		if s.app.Options().RpcCompleteHandler != nil {
+			s.app.Options().RpcCompleteHandler(s.app, s.module, callInfo, input, rs, time.Since(start))
+		}
+		switch e := rs[1].(type) {
+		case string:
+			if e != "" {
+				return rs[0], mqrpc.NewError(mqrpc.CodeBusiness, "%s", e)
+			}
+		case *mqrpc.Error:
+			//handler自行指定了错误码
+			if e != nil {
+				return rs[0], e
+			}
+		case error:
+			return rs[0], mqrpc.WrapError(mqrpc.CodeBusiness, e)
+		case nil:
+		default:
+			return nil, mqrpc.NewError(mqrpc.CodeInternal, "%s rpc func(%s) return error %s\n", s.module.GetType(), callInfo.RPCInfo.Fn, "func(....)(result interface{}, err error)")
 		}
+		return rs[0], nil
 	}
-	if s.app.Options().RpcCompleteHandler != nil {
-		s.app.Options().RpcCompleteHandler(s.app, s.module, callInfo, input, rs, time.Since(start))
-	}
-	var rerr string
-	switch e := rs[1].(type) {
-	case string:
-		rerr = e
-		break
-	case error:
-		rerr = e.Error()
-	case nil:
-		rerr = ""
-	default:
-		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("%s rpc func(%s) return error %s\n", s.module.GetType(), callInfo.RPCInfo.Fn, "func(....)(result interface{}, err error)"))
-		return
+	middlewares := append(append([]mqrpc.ServerMiddleware{}, s.middlewares...), functionInfo.Middlewares...)
+	result, herr := mqrpc.ChainServerMiddlewares(middlewares, handler)(callInfo, margs)
+	//中间件返回的普通error没有错误码
+	rerr := mqrpc.WrapError(mqrpc.CodeUnknown, herr)
+	if stream != nil {
+		//先关闭流,保证结束标记是最后一条消息
+		stream.Close()
 	}
-	argsType, args, err := argsutil.ArgsTypeAnd2Bytes(s.app, rs[0])
+	argsType, args, err := argsutil.ArgsTypeAnd2Bytes(s.app, result)
 	if err != nil {
-		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeInternal, err))
 		return
 	}
 	resultInfo := rpcpb.NewResultInfo(
 		callInfo.RPCInfo.Cid,
-		rerr,
+		"",
 		argsType,
 		args,
 	)
+	if rerr != nil {
+		resultInfo.Error = rerr.Message
+		resultInfo.ErrorInfo = s.errorInfo(rerr)
+	}
+	//流式调用以最后一条应答作为结束标记
+	resultInfo.EOS = callInfo.RPCInfo.Stream
 	callInfo.Result = resultInfo
 	callInfo.ExecTime = time.Since(start).Nanoseconds()
 	s.doCallback(callInfo)
@@ -388,28 +806,122 @@ func (s *RPCServer) runFunc(callInfo *mqrpc.CallInfo) {
 				rn = r.(error).Error()
 			}
 			log.Error("recover", rn)
-			s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, rn)
+			s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.NewError(mqrpc.CodeInternal, "%s", rn))
 		}
 	}()
 
-	if s.control != nil {
-		//协程数量达到最大限制
-		s.control.Wait()
-	}
+	s.functionsLock.RLock()
 	functionInfo, ok := s.functions[callInfo.RPCInfo.Fn]
+	s.functionsLock.RUnlock()
 	if !ok {
 		if s.listener != nil {
 			fInfo, err := s.listener.NoFoundFunction(callInfo.RPCInfo.Fn)
 			if err != nil {
-				s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
+				s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.WrapError(mqrpc.CodeNotFound, err))
 				return
 			}
 			functionInfo = fInfo
 		}
 	}
+	if functionInfo == nil {
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, mqrpc.NewError(mqrpc.CodeNotFound, "Remote function(%s) not found", callInfo.RPCInfo.Fn))
+		return
+	}
+	if functionInfo.Idempotent > 0 {
+		key := idempotencyKey(callInfo)
+		entry, first := s.idempotency.begin(key, functionInfo.Idempotent)
+		if !first {
+			//重复的请求不执行handler
+			go s.replay(start, entry, callInfo)
+			return
+		}
+		callInfo.IdempotencyKey = key
+	}
+	s.execute(start, functionInfo, callInfo)
+}
+
+/**
+按照协程控制器的限制执行handler
+控制器是协程池(mqrpc.Executor)时RegisterGO注册的handler交给协程池排队执行,
+其他控制器需要先Wait获得名额,控制器拒绝的请求以CodeOverloaded返回给调用方
+*/
+func (s *RPCServer) execute(start time.Time, functionInfo *mqrpc.FunctionInfo, callInfo *mqrpc.CallInfo) {
+	if s.canceledBeforeStart(callInfo) {
+		s.refuseCanceled(start, callInfo)
+		return
+	}
+	s.drainLock.RLock()
+	if s.draining {
+		s.drainLock.RUnlock()
+		s.refuse(start, callInfo, s.drainingError(callInfo))
+		return
+	}
+	s.wg.Add(1)
+	s.drainLock.RUnlock()
+	run := func() {
+		atomic.AddInt64(&s.executing, 1)
+		defer func() {
+			atomic.AddInt64(&s.executing, -1)
+			s.wg.Done()
+		}()
+		if m := s.app.Options().Metrics; m != nil {
+			defer m.ServerBegin(s.module.GetType(), s.nodeID(), callInfo.RPCInfo.Fn)()
+		}
+		s._runFunc(start, functionInfo, callInfo)
+	}
+	overload := func(err error) {
+		defer s.wg.Done()
+		e := mqrpc.NewError(mqrpc.CodeOverloaded, "%s rpc func(%s) %v", s.module.GetType(), callInfo.RPCInfo.Fn, err)
+		e.Retryable = true
+		s.refuse(start, callInfo, e)
+	}
+	control := s.control
+	if control == nil {
+		if functionInfo.Goroutine {
+			go run()
+		} else {
+			run()
+		}
+		return
+	}
+	if executor, ok := control.(mqrpc.Executor); ok {
+		if !functionInfo.Goroutine {
+			//同步handler在接收协程中执行,不占用协程池
+			run()
+		} else if err := executor.Submit(run, overload); err != nil {
+			overload(err)
+		}
+		return
+	}
+	if err := control.Wait(); err != nil {
+		overload(err)
+		return
+	}
+	finish := func() {
+		defer control.Finish()
+		run()
+	}
 	if functionInfo.Goroutine {
-		go s._runFunc(start, functionInfo, callInfo)
+		go finish()
 	} else {
-		s._runFunc(start, functionInfo, callInfo)
+		finish()
 	}
 }
+
+/**
+请求没有执行(服务端过载或者正在下线)
+*/
+func (s *RPCServer) refuse(start time.Time, callInfo *mqrpc.CallInfo, e *mqrpc.Error) {
+	if callInfo.IdempotencyKey != "" {
+		//handler没有执行,重试时可以重新执行
+		s.idempotency.abort(callInfo.IdempotencyKey)
+		callInfo.IdempotencyKey = ""
+	}
+	s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, e)
+}
+
+func (s *RPCServer) drainingError(callInfo *mqrpc.CallInfo) *mqrpc.Error {
+	e := mqrpc.NewError(mqrpc.CodeUnavailable, "%s rpc func(%s) node draining", s.module.GetType(), callInfo.RPCInfo.Fn)
+	e.Retryable = true
+	return e
+}
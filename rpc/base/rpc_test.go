@@ -0,0 +1,210 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/app"
+	"github.com/liangdas/mqant/conf"
+	"github.com/liangdas/mqant/module"
+	basemodule "github.com/liangdas/mqant/module/base"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/base"
+	"github.com/liangdas/mqant/rpc/pb"
+	"github.com/liangdas/mqant/transport/memory"
+)
+
+type testModule struct {
+	app module.App
+}
+
+func (m *testModule) Version() string                             { return "1.0.0" }
+func (m *testModule) GetType() string                             { return "test" }
+func (m *testModule) OnAppConfigurationLoaded(app module.App)     { m.app = app }
+func (m *testModule) OnConfChanged(settings *conf.ModuleSettings) {}
+func (m *testModule) OnInit(app module.App, settings *conf.ModuleSettings) {
+	m.app = app
+}
+func (m *testModule) OnDestroy()             {}
+func (m *testModule) GetApp() module.App     { return m.app }
+func (m *testModule) Run(closeSig chan bool) {}
+
+type testListener struct {
+	timeouts chan string
+}
+
+func (l *testListener) NoFoundFunction(fn string) (*mqrpc.FunctionInfo, error) {
+	return nil, fmt.Errorf("Remote function(%s) not found", fn)
+}
+func (l *testListener) BeforeHandle(fn string, callInfo *mqrpc.CallInfo) error { return nil }
+func (l *testListener) OnTimeOut(fn string, Expired int64)                     { l.timeouts <- fn }
+func (l *testListener) OnError(fn string, callInfo *mqrpc.CallInfo, err error) {}
+func (l *testListener) OnComplete(fn string, callInfo *mqrpc.CallInfo, result *rpcpb.ResultInfo, execTime int64) {
+}
+
+func newTestSession(t *testing.T, opts ...module.Option) (mqrpc.RPCServer, module.ServerSession, func()) {
+	opts = append(opts, module.Transport(memory.NewTransport()))
+	a := app.NewApp(opts...)
+	server, err := defaultrpc.NewRPCServer(a, &testModule{app: a})
+	if err != nil {
+		t.Fatalf("Unexpected error creating rpc server: %v", err)
+	}
+	server.RegisterGO("add", func(a int64, b int64) (int64, error) {
+		return a + b, nil
+	})
+	server.Register("sleep", func(ms int64) (string, string) {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return "", ""
+	})
+	server.Register("echo", func(s string) (string, string) {
+		if s == "" {
+			return "", "empty"
+		}
+		return s, ""
+	})
+	server.Register("fail", func(retryable bool) (string, error) {
+		e := mqrpc.NewError(mqrpc.CodeUnavailable, "try again")
+		e.Retryable = retryable
+		return "", e
+	})
+	session, err := basemodule.NewServerSession(a, "test", &registry.Node{
+		Id:      "test@1",
+		Address: server.Addr(),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating session: %v", err)
+	}
+	// 等待订阅完成
+	time.Sleep(time.Millisecond * 50)
+	return server, session, func() {
+		session.GetRPC().Done()
+		server.Done()
+	}
+}
+
+func testCall(t *testing.T, session module.ServerSession) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	result, errstr := session.Call(ctx, "add", int64(1), int64(2))
+	if errstr != "" {
+		t.Fatalf("Unexpected error calling add: %v", errstr)
+	}
+	if result != int64(3) {
+		t.Fatalf("Expected 3, got %v", result)
+	}
+
+	result, errstr = session.Call(ctx, "echo", "hello")
+	if errstr != "" || result != "hello" {
+		t.Fatalf("Expected hello, got %v %v", result, errstr)
+	}
+
+	_, errstr = session.Call(ctx, "echo", "")
+	if errstr != "empty" {
+		t.Fatalf("Expected error empty, got %v", errstr)
+	}
+
+	_, errstr = session.Call(ctx, "nofound")
+	if errstr == "" {
+		t.Fatal("Expected error calling an unregistered function")
+	}
+
+	if err := session.CallNR("echo", "hello"); err != nil {
+		t.Fatalf("Unexpected error calling echo: %v", err)
+	}
+
+	_, err := session.CallE(ctx, "nofound")
+	if mqrpc.ErrorCode(err) != mqrpc.CodeNotFound {
+		t.Fatalf("Expected CodeNotFound, got %v", err)
+	}
+	_, err = session.CallE(ctx, "echo", "")
+	if mqrpc.ErrorCode(err) != mqrpc.CodeBusiness || err.Error() != "empty" {
+		t.Fatalf("Expected CodeBusiness empty, got %v", err)
+	}
+	if err.(*mqrpc.Error).Node == "" {
+		t.Fatal("Expected the error to carry the originating node")
+	}
+	_, err = session.CallE(ctx, "fail", true)
+	if mqrpc.ErrorCode(err) != mqrpc.CodeUnavailable || !mqrpc.IsRetryable(err) {
+		t.Fatalf("Expected retryable CodeUnavailable, got %v", err)
+	}
+	_, err = session.CallE(ctx, "add", int64(1))
+	if mqrpc.ErrorCode(err) != mqrpc.CodeInvalidArgument {
+		t.Fatalf("Expected CodeInvalidArgument, got %v", err)
+	}
+	result, err = session.CallE(ctx, "add", int64(1), int64(2))
+	if err != nil || result != int64(3) {
+		t.Fatalf("Expected 3, got %v %v", result, err)
+	}
+}
+
+func TestTransportCall(t *testing.T) {
+	_, session, done := newTestSession(t, module.LocalRPC(false))
+	defer done()
+	testCall(t, session)
+}
+
+func TestLocalCall(t *testing.T) {
+	_, session, done := newTestSession(t, module.LocalRPC(true))
+	defer done()
+	testCall(t, session)
+}
+
+func TestConcurrentCall(t *testing.T) {
+	for _, local := range []bool{true, false} {
+		_, session, done := newTestSession(t, module.LocalRPC(local))
+		defer done()
+		errs := make(chan error, 100)
+		for i := 0; i < 100; i++ {
+			go func(i int64) {
+				ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+				defer cancel()
+				result, errstr := session.Call(ctx, "add", i, int64(1))
+				if errstr != "" {
+					errs <- fmt.Errorf("%s", errstr)
+					return
+				}
+				if result != i+1 {
+					errs <- fmt.Errorf("expected %v, got %v", i+1, result)
+					return
+				}
+				errs <- nil
+			}(int64(i))
+		}
+		for i := 0; i < 100; i++ {
+			if err := <-errs; err != nil {
+				t.Fatalf("local=%v %v", local, err)
+			}
+		}
+	}
+}
+
+func TestServerDeadline(t *testing.T) {
+	for _, local := range []bool{true, false} {
+		server, session, done := newTestSession(t, module.LocalRPC(local), module.RPCExpired(time.Millisecond*200))
+		defer done()
+		listener := &testListener{timeouts: make(chan string, 10)}
+		server.SetListener(listener)
+
+		// 串行执行的handler阻塞住后续请求
+		if err := session.CallNR("sleep", int64(400)); err != nil {
+			t.Fatalf("Unexpected error calling sleep: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*300)
+		_, err := session.CallE(ctx, "echo", "hello")
+		cancel()
+		if mqrpc.ErrorCode(err) != mqrpc.CodeDeadlineExceeded {
+			t.Fatalf("local=%v Expected deadline exceeded, got %v", local, err)
+		}
+		select {
+		case fn := <-listener.timeouts:
+			if fn != "echo" {
+				t.Fatalf("local=%v Expected timeout of echo, got %v", local, fn)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("local=%v Expected OnTimeOut to be called", local)
+		}
+	}
+}
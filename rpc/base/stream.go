@@ -0,0 +1,332 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package defaultrpc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+
+	mqrpc "github.com/liangdas/mqant/rpc"
+	rpcpb "github.com/liangdas/mqant/rpc/pb"
+	argsutil "github.com/liangdas/mqant/rpc/util"
+)
+
+var streamType = reflect.TypeOf((*mqrpc.Stream)(nil)).Elem()
+
+type streamRequest struct {
+	service string
+	method  string
+	args    []interface{}
+}
+
+func (r *streamRequest) Service() string {
+	return r.service
+}
+
+func (r *streamRequest) Method() string {
+	return r.method
+}
+
+func (r *streamRequest) ContentType() string {
+	return ""
+}
+
+func (r *streamRequest) Request() interface{} {
+	return r.args
+}
+
+func (r *streamRequest) Stream() bool {
+	return true
+}
+
+/**
+服务端的流
+每发送一条消息消耗一个窗口,窗口用完后Send阻塞,直到调用方确认或者取消
+*/
+type serverStream struct {
+	server   *RPCServer
+	callInfo *mqrpc.CallInfo
+	ctx      context.Context
+	cancel   context.CancelFunc
+	request  *streamRequest
+	sendLock sync.Mutex //保证seq与发送顺序一致
+	lock     sync.Mutex
+	credit   int64
+	signal   chan struct{}
+	seq      int64
+	closed   bool
+	err      error
+}
+
+func newServerStream(server *RPCServer, callInfo *mqrpc.CallInfo, ctx context.Context, cancel context.CancelFunc) *serverStream {
+	window := int64(callInfo.RPCInfo.Window)
+	if window <= 0 {
+		window = int64(mqrpc.DefaultStreamWindow)
+	}
+	return &serverStream{
+		server:   server,
+		callInfo: callInfo,
+		ctx:      ctx,
+		cancel:   cancel,
+		request: &streamRequest{
+			service: server.module.GetType(),
+			method:  callInfo.RPCInfo.Fn,
+		},
+		credit: window,
+		signal: make(chan struct{}, 1),
+	}
+}
+
+func (st *serverStream) Context() context.Context {
+	return st.ctx
+}
+
+func (st *serverStream) Request() mqrpc.Request {
+	return st.request
+}
+
+func (st *serverStream) Send(msg interface{}) error {
+	argsType, data, err := argsutil.ArgsTypeAnd2Bytes(st.server.app, msg)
+	if err != nil {
+		return err
+	}
+	st.sendLock.Lock()
+	defer st.sendLock.Unlock()
+	st.lock.Lock()
+	for st.credit <= 0 && !st.closed {
+		st.lock.Unlock()
+		select {
+		case <-st.signal:
+		case <-st.ctx.Done():
+			return st.setError(st.ctx.Err())
+		}
+		st.lock.Lock()
+	}
+	if st.closed {
+		st.lock.Unlock()
+		return mqrpc.ErrStreamClosed
+	}
+	if err := st.ctx.Err(); err != nil {
+		st.lock.Unlock()
+		return st.setError(err)
+	}
+	st.credit--
+	st.seq++
+	resultInfo := rpcpb.NewResultInfo(st.callInfo.RPCInfo.Cid, "", argsType, data)
+	resultInfo.Seq = st.seq
+	resultInfo.Node = st.server.nodeAddr()
+	st.lock.Unlock()
+	callInfo := &mqrpc.CallInfo{
+		RPCInfo: st.callInfo.RPCInfo,
+		Result:  resultInfo,
+		Props:   st.callInfo.Props,
+		Agent:   st.callInfo.Agent,
+	}
+	if err := callInfo.Agent.Callback(callInfo); err != nil {
+		return st.setError(err)
+	}
+	return nil
+}
+
+func (st *serverStream) Recv(interface{}) error {
+	return mqrpc.ErrStreamNotSupported
+}
+
+func (st *serverStream) Error() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.err
+}
+
+/**
+handler主动结束流,之后的Send都会失败
+结束标记在handler返回后发送
+*/
+func (st *serverStream) Close() error {
+	st.lock.Lock()
+	st.closed = true
+	st.lock.Unlock()
+	st.wakeup()
+	return nil
+}
+
+func (st *serverStream) setError(err error) error {
+	st.lock.Lock()
+	st.err = err
+	st.lock.Unlock()
+	return err
+}
+
+func (st *serverStream) wakeup() {
+	select {
+	case st.signal <- struct{}{}:
+	default:
+	}
+}
+
+/**
+调用方确认消费了n条消息
+*/
+func (st *serverStream) ack(n int32) {
+	st.lock.Lock()
+	st.credit += int64(n)
+	st.lock.Unlock()
+	st.wakeup()
+}
+
+/**
+调用方的流
+*/
+type clientStream struct {
+	client   *RPCClient
+	ctx      context.Context
+	cancel   context.CancelFunc
+	end      func(r interface{}, e *mqrpc.Error) //流结束时记录调用方监控、指标与span
+	request  *streamRequest
+	rpcInfo  *rpcpb.RPCInfo
+	results  chan *rpcpb.ResultInfo
+	window   int
+	consumed int
+	seq      int64
+	node     string //处理请求的节点地址,控制消息发送到该节点
+	lock     sync.Mutex
+	finished bool
+	err      error
+}
+
+func (st *clientStream) Context() context.Context {
+	return st.ctx
+}
+
+func (st *clientStream) Request() mqrpc.Request {
+	return st.request
+}
+
+func (st *clientStream) Send(interface{}) error {
+	return mqrpc.ErrStreamNotSupported
+}
+
+/**
+读取下一条消息到v中,v必须是指针
+流正常结束时返回io.EOF,服务端返回错误时返回*mqrpc.Error
+*/
+func (st *clientStream) Recv(v interface{}) error {
+	if err := st.Error(); err != nil {
+		return err
+	}
+	select {
+	case resultInfo, ok := <-st.results:
+		if !ok {
+			return st.finish(st.client.newError(mqrpc.CodeUnavailable, "client closed"), false)
+		}
+		if resultInfo.EOS {
+			if e := mqrpc.ResultError(resultInfo); e != nil {
+				return st.finish(e, false)
+			}
+			return st.finish(io.EOF, false)
+		}
+		if resultInfo.Seq != st.seq+1 {
+			//中间有消息丢失
+			return st.finish(st.client.newError(mqrpc.CodeInternal, "stream out of sequence, expected %d got %d", st.seq+1, resultInfo.Seq), true)
+		}
+		st.seq = resultInfo.Seq
+		if resultInfo.Node != "" {
+			st.setNode(resultInfo.Node)
+		}
+		st.consumed++
+		if st.consumed*2 >= st.window {
+			//消费了一半窗口后通知服务端继续发送
+			st.client.sendControl(st.rpcInfo, st.getNode(), mqrpc.ControlAck, int32(st.consumed))
+			st.consumed = 0
+		}
+		value, err := argsutil.Bytes2Args(st.client.app, resultInfo.ResultType, resultInfo.Result)
+		if err != nil {
+			return err
+		}
+		return mqrpc.Assign(v, value)
+	case <-st.ctx.Done():
+		err := st.Error()
+		if err == nil {
+			err = st.finish(st.client.newError(mqrpc.CodeDeadlineExceeded, "deadline exceeded"), true)
+		}
+		return err
+	}
+}
+
+func (st *clientStream) setNode(node string) {
+	st.lock.Lock()
+	st.node = node
+	st.lock.Unlock()
+}
+
+func (st *clientStream) getNode() string {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.node
+}
+
+func (st *clientStream) Error() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.err
+}
+
+/**
+调用方放弃读取,通知服务端结束handler
+*/
+func (st *clientStream) Close() error {
+	st.finish(mqrpc.ErrStreamClosed, true)
+	return nil
+}
+
+/**
+结束流,只有第一次调用生效
+notify 为true时通知服务端取消
+*/
+func (st *clientStream) finish(err error, notify bool) error {
+	st.lock.Lock()
+	if st.finished {
+		err = st.err
+		st.lock.Unlock()
+		return err
+	}
+	st.finished = true
+	st.err = err
+	st.lock.Unlock()
+	if notify {
+		st.client.sendControl(st.rpcInfo, st.getNode(), mqrpc.ControlCancel, 0)
+	}
+	st.client.nats_client.Delete(st.rpcInfo.Cid)
+	st.client.local_client.Delete(st.rpcInfo.Cid)
+	st.cancel()
+	if st.end != nil {
+		//正常结束与调用方主动关闭都不算失败
+		var e *mqrpc.Error
+		if err != io.EOF && err != mqrpc.ErrStreamClosed {
+			e = mqrpc.WrapError(mqrpc.CodeInternal, err)
+		}
+		st.end(nil, e)
+	}
+	return err
+}
+
+/**
+ctx结束时通知服务端取消
+*/
+func (st *clientStream) watch() {
+	<-st.ctx.Done()
+	st.finish(st.client.newError(mqrpc.CodeDeadlineExceeded, "deadline exceeded"), true)
+}
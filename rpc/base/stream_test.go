@@ -0,0 +1,163 @@
+package defaultrpc_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/metrics"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/tracing"
+)
+
+func TestStream(t *testing.T) {
+	for _, local := range []bool{true, false} {
+		server, session, done := newTestSession(t, module.LocalRPC(local))
+		defer done()
+		canceled := make(chan error, 1)
+		server.Register("count", func(n int64, stream mqrpc.Stream) error {
+			for i := int64(0); i < n; i++ {
+				if err := stream.Send(i); err != nil {
+					return err
+				}
+			}
+			if n == 3 {
+				return fmt.Errorf("stop at %d", n)
+			}
+			return nil
+		})
+		server.RegisterGO("tail", func(ctx context.Context, stream mqrpc.Stream) error {
+			for i := int64(0); ; i++ {
+				if err := stream.Send(i); err != nil {
+					canceled <- err
+					return err
+				}
+			}
+		})
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+		// 超过窗口大小,需要调用方确认后才能继续发送
+		stream, err := session.CallStream(ctx, "count", int64(100))
+		if err != nil {
+			t.Fatalf("Unexpected error calling count: %v", err)
+		}
+		for i := int64(0); i < 100; i++ {
+			var v int64
+			if err := stream.Recv(&v); err != nil {
+				t.Fatalf("local=%v Unexpected error receiving %d: %v", local, i, err)
+			}
+			if v != i {
+				t.Fatalf("local=%v Expected %d, got %d", local, i, v)
+			}
+		}
+		if err := stream.Recv(nil); err != io.EOF {
+			t.Fatalf("local=%v Expected io.EOF, got %v", local, err)
+		}
+
+		stream, err = session.CallStream(ctx, "count", int64(3))
+		if err != nil {
+			t.Fatalf("Unexpected error calling count: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := stream.Recv(nil); err != nil {
+				t.Fatalf("local=%v Unexpected error receiving: %v", local, err)
+			}
+		}
+		if err := stream.Recv(nil); mqrpc.ErrorCode(err) != mqrpc.CodeBusiness {
+			t.Fatalf("local=%v Expected handler error, got %v", local, err)
+		}
+
+		stream, err = session.CallStream(ctx, "tail")
+		if err != nil {
+			t.Fatalf("Unexpected error calling tail: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := stream.Recv(nil); err != nil {
+				t.Fatalf("local=%v Unexpected error receiving: %v", local, err)
+			}
+		}
+		stream.Close()
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatalf("local=%v Expected the handler to be canceled", local)
+		}
+
+		_, err = session.CallE(ctx, "count", int64(1))
+		if mqrpc.ErrorCode(err) != mqrpc.CodeInvalidArgument {
+			t.Fatalf("local=%v Expected stream mismatch, got %v", local, err)
+		}
+		cancel()
+	}
+}
+
+func TestStreamPipeline(t *testing.T) {
+	var intercepted []string
+	intercept := func(ctx context.Context, callInfo *mqrpc.CallInfo, invoker mqrpc.ClientInvoker) (interface{}, error) {
+		intercepted = append(intercepted, callInfo.RPCInfo.Fn)
+		if callInfo.RPCInfo.Fn == "denied" {
+			return nil, fmt.Errorf("permission denied")
+		}
+		return invoker(ctx, callInfo)
+	}
+	m := metrics.NewRPCMetrics(nil)
+	exporter := &testExporter{}
+	server, session, done := newTestSession(t, module.ClientInterceptor(intercept), module.Metrics(m), module.Tracer(tracing.NewTracer(exporter)))
+	defer done()
+	server.RegisterGO("info", func(ctx context.Context, stream mqrpc.Stream) error {
+		_, ok := ctx.Deadline()
+		if err := stream.Send(ok); err != nil {
+			return err
+		}
+		_, traced := mqrpc.MetadataFromContext(ctx)[tracing.TraceparentHeader]
+		return stream.Send(traced)
+	})
+
+	// 没有超时时间的ctx也使用RPCExpired
+	stream, err := session.CallStream(context.TODO(), "info")
+	if err != nil {
+		t.Fatalf("Unexpected error calling info: %v", err)
+	}
+	var deadline, traced bool
+	if err := stream.Recv(&deadline); err != nil || !deadline {
+		t.Fatalf("Expected the handler to run with a deadline, got %v %v", deadline, err)
+	}
+	if err := stream.Recv(&traced); err != nil || !traced {
+		t.Fatalf("Expected the traceparent to be sent, got %v %v", traced, err)
+	}
+	if err := stream.Recv(nil); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+	if _, err := session.CallStream(context.TODO(), "denied"); mqrpc.ErrorCode(err) != mqrpc.CodeRejected {
+		t.Fatalf("Expected CodeRejected, got %v", err)
+	}
+	if len(intercepted) != 2 || intercepted[0] != "info" {
+		t.Fatalf("Expected stream calls to go through the interceptors, got %v", intercepted)
+	}
+
+	var buf bytes.Buffer
+	m.Registry().WriteText(&buf)
+	text := buf.String()
+	for _, line := range []string{
+		`mqant_rpc_client_calls_total{module="test",node="test@1",func="info"} 1`,
+		`mqant_rpc_client_in_flight{module="test",node="test@1",func="info"} 0`,
+		`mqant_rpc_client_errors_total{module="test",node="test@1",func="denied",code="` + fmt.Sprint(mqrpc.CodeRejected) + `"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("Expected %s in:\n%s", line, text)
+		}
+	}
+	found := false
+	for _, span := range exporter.wait(3) {
+		if span.Name == "test/info" && span.Kind == "client" && span.Error == "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected a client span for the stream, got %+v", exporter.spans)
+	}
+}
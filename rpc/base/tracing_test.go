@@ -0,0 +1,84 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/tracing"
+)
+
+type testExporter struct {
+	lock  sync.Mutex
+	spans []*tracing.SpanData
+}
+
+func (e *testExporter) Export(span *tracing.SpanData) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+/*
+*
+等待导出n个span
+*/
+func (e *testExporter) wait(n int) []*tracing.SpanData {
+	for i := 0; i < 100; i++ {
+		e.lock.Lock()
+		spans := e.spans
+		e.lock.Unlock()
+		if len(spans) >= n {
+			return spans
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &testExporter{}
+	tracer := tracing.NewTracer(exporter)
+	server, session, done := newTestSession(t, module.Tracer(tracer))
+	defer done()
+	server.RegisterGO("nested", func(ctx context.Context) (string, error) {
+		// 使用handler收到的ctx继续调用,成为handler span的子span
+		_, err := session.CallE(ctx, "echo", "")
+		return "", err
+	})
+
+	ctx, root := tracer.Start(context.TODO(), "root", tracing.SpanKindInternal)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := session.CallE(ctx, "nested"); err == nil {
+		t.Fatal("Expected the nested error to be returned")
+	}
+	root.End()
+
+	exported := exporter.wait(5)
+	if exported == nil {
+		t.Fatalf("Expected 5 spans, got %+v", exporter.spans)
+	}
+	spans := map[string]*tracing.SpanData{}
+	for _, span := range exported {
+		spans[span.Name+"/"+span.Kind] = span
+		if span.TraceID != root.SpanContext().TraceID.String() {
+			t.Fatalf("All spans should belong to the root trace: %+v", span)
+		}
+	}
+	chain := []string{"test/nested/client", "test/nested/server", "test/echo/client", "test/echo/server"}
+	parent := root.SpanContext().SpanID.String()
+	for _, key := range chain {
+		span := spans[key]
+		if span == nil || span.ParentSpanID != parent {
+			t.Fatalf("Expected %s to be a child of %s: %+v", key, parent, spans)
+		}
+		parent = span.SpanID
+	}
+	if spans["test/echo/server"].Error != "empty" || spans["test/nested/client"].Error != "empty" {
+		t.Fatalf("Errors should be recorded on the spans: %+v", spans)
+	}
+}
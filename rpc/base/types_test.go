@@ -0,0 +1,68 @@
+package defaultrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/rpc/pb"
+)
+
+type testScore struct {
+	Score int64
+}
+
+func (s *testScore) Marshal() ([]byte, error) { return json.Marshal(s) }
+func (s *testScore) Unmarshal(b []byte) error { return json.Unmarshal(b, s) }
+func (s *testScore) String() string           { return "" }
+
+func TestCallInto(t *testing.T) {
+	mqrpc.RegisterType(&testScore{})
+	server, session, done := newTestSession(t)
+	defer done()
+	server.RegisterGO("score", func(n int64) (*testScore, error) {
+		return &testScore{Score: n}, nil
+	})
+	server.RegisterGO("info", func(code int32) (*rpcpb.RPCError, error) {
+		return &rpcpb.RPCError{Code: code, Message: "info"}, nil
+	})
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+
+	// 登记过的类型直接解码为该类型
+	result, err := session.CallE(ctx, "score", int64(42))
+	if err != nil {
+		t.Fatalf("Unexpected error calling score: %v", err)
+	}
+	if s, ok := result.(*testScore); !ok || s.Score != 42 {
+		t.Fatalf("Expected *testScore, got %#v", result)
+	}
+	score := &testScore{}
+	if err := session.CallInto(ctx, "score", score, int64(7)); err != nil || score.Score != 7 {
+		t.Fatalf("Unexpected CallInto result %v %v", score, err)
+	}
+	if err := mqrpc.Marshal(score, func() (interface{}, interface{}) { return session.Call(ctx, "score", int64(8)) }); err != nil || score.Score != 8 {
+		t.Fatalf("mqrpc.Marshal should accept decoded results %v %v", score, err)
+	}
+
+	// 没有登记的proto仍然返回[]byte,CallInto按out的类型解码
+	result, err = session.CallE(ctx, "info", int32(3))
+	if _, ok := result.([]byte); err != nil || !ok {
+		t.Fatalf("Expected []byte for unregistered types, got %#v %v", result, err)
+	}
+	info := &rpcpb.RPCError{}
+	if err := session.CallInto(ctx, "info", info, int32(3)); err != nil || info.Code != 3 || info.Message != "info" {
+		t.Fatalf("Unexpected CallInto result %v %v", info, err)
+	}
+
+	var sum int
+	if err := session.CallInto(ctx, "add", &sum, int64(1), int64(2)); err != nil || sum != 3 {
+		t.Fatalf("Unexpected CallInto result %v %v", sum, err)
+	}
+	var wrong map[string]string
+	if err := session.CallInto(ctx, "add", &wrong, int64(1), int64(2)); mqrpc.ErrorCode(err) != mqrpc.CodeInternal {
+		t.Fatalf("Expected decode error, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"fmt"
+
+	"github.com/liangdas/mqant/rpc/pb"
+)
+
+// RPC错误码
+const (
+	// CodeOK 没有错误
+	CodeOK int32 = iota
+	// CodeUnknown 未分类的错误,例如旧版本服务端只返回了错误字符串
+	CodeUnknown
+	// CodeInvalidArgument 参数个数不匹配或者参数无法解析
+	CodeInvalidArgument
+	// CodeNotFound 远程函数不存在
+	CodeNotFound
+	// CodeDeadlineExceeded 调用超时
+	CodeDeadlineExceeded
+	// CodeUnavailable 服务不可用,例如找不到服务节点或者消息发送失败
+	CodeUnavailable
+	// CodeInternal handler执行异常(panic)或者返回值不合法
+	CodeInternal
+	// CodeRejected 请求被客户端拦截器或者RPCListener.BeforeHandle拒绝
+	CodeRejected
+	// CodeBusiness handler返回的业务错误
+	CodeBusiness
+	// CodeCanceled 调用方主动取消了请求
+	CodeCanceled
+	// CodeOverloaded 服务端协程池已满,请求没有执行,可以换一个节点重试
+	CodeOverloaded
+)
+
+// Error 结构化的RPC错误
+// handler可以直接返回*Error来指定错误码,否则服务端会按照出错的位置自动填充
+type Error struct {
+	Code      int32
+	Message   string
+	Details   string
+	Retryable bool   //是否可以重试
+	Node      string //产生错误的节点
+}
+
+// Error 只返回错误信息,与原来字符串形式的错误保持一致
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// String 包含全部错误信息,用于日志
+func (e *Error) String() string {
+	return fmt.Sprintf("code=%d message=%s details=%s retryable=%v node=%s", e.Code, e.Message, e.Details, e.Retryable, e.Node)
+}
+
+// NewError 创建一个RPC错误
+func NewError(code int32, format string, a ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// WrapError 将普通的error转换为*Error,如果已经是*Error则原样返回
+func WrapError(code int32, err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
+// ErrorCode 获取错误码,不是*Error时返回CodeUnknown
+func ErrorCode(err error) int32 {
+	if err == nil {
+		return CodeOK
+	}
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// IsRetryable 错误是否可以重试
+func IsRetryable(err error) bool {
+	if e, ok := err.(*Error); ok && e != nil {
+		return e.Retryable
+	}
+	return false
+}
+
+// ToPB 转换为可以传输的protobuf结构
+func (e *Error) ToPB() *rpcpb.RPCError {
+	return &rpcpb.RPCError{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		Retryable: e.Retryable,
+		Node:      e.Node,
+	}
+}
+
+// ResultError 从应答中解析错误,没有错误时返回nil
+// 兼容只设置了Error字符串的旧版本服务端
+func ResultError(result *rpcpb.ResultInfo) *Error {
+	if result == nil {
+		return nil
+	}
+	if pe := result.GetErrorInfo(); pe != nil {
+		return &Error{
+			Code:      pe.Code,
+			Message:   pe.Message,
+			Details:   pe.Details,
+			Retryable: pe.Retryable,
+			Node:      pe.Node,
+		}
+	}
+	if result.Error != "" {
+		return &Error{
+			Code:    CodeUnknown,
+			Message: result.Error,
+		}
+	}
+	return nil
+}
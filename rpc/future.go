@@ -0,0 +1,81 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Future 异步调用的结果,调用完成后Done返回的通道会被关闭
+// 取消异步调用需要取消发起调用时传入的ctx
+type Future struct {
+	once   sync.Once
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+// NewFuture 创建一个未完成的Future
+func NewFuture() *Future {
+	return &Future{
+		done: make(chan struct{}),
+	}
+}
+
+// Complete 设置调用结果,只有第一次调用生效
+func (f *Future) Complete(result interface{}, err error) {
+	f.once.Do(func() {
+		f.result = result
+		f.err = err
+		close(f.done)
+	})
+}
+
+// Done 调用完成后关闭的通道,可以用在select中
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result 阻塞直到调用完成,返回结果与错误
+func (f *Future) Result() (interface{}, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// Wait 阻塞直到调用完成或者ctx结束,ctx结束时不会取消调用本身
+func (f *Future) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return nil, WrapError(CodeCanceled, ctx.Err())
+		}
+		return nil, WrapError(CodeDeadlineExceeded, ctx.Err())
+	}
+}
+
+// Into 阻塞直到调用完成,并将结果解码到out中,out必须是指针
+func (f *Future) Into(out interface{}) error {
+	result, err := f.Result()
+	if err != nil {
+		return err
+	}
+	if e := Assign(out, result); e != nil {
+		return WrapError(CodeInternal, e)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"context"
+)
+
+// ClientInvoker 发送请求并等待结果
+// callInfo.RPCInfo.Reply为false时不等待回复,直接返回nil结果
+type ClientInvoker func(ctx context.Context, callInfo *CallInfo) (interface{}, error)
+
+// ClientInterceptor 客户端拦截器
+// 可以修改callInfo.RPCInfo,直接返回结果而不调用invoker,多次调用invoker进行重试,或者返回error拒绝本次调用
+type ClientInterceptor func(ctx context.Context, callInfo *CallInfo, invoker ClientInvoker) (interface{}, error)
+
+// ChainClientInterceptors 将拦截器串联起来,排在前面的拦截器在最外层
+func ChainClientInterceptors(interceptors []ClientInterceptor, invoker ClientInvoker) ClientInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, callInfo *CallInfo) (interface{}, error) {
+			return interceptor(ctx, callInfo, next)
+		}
+	}
+	return invoker
+}
+
+// ServerHandler 执行handler,args为解码后的参数
+type ServerHandler func(callInfo *CallInfo, args []interface{}) (interface{}, error)
+
+// ServerMiddleware 服务端中间件
+// 可以查看或替换参数,在handler前后执行额外逻辑(计时,panic处理,事务等),也可以改写结果和错误
+type ServerMiddleware func(callInfo *CallInfo, args []interface{}, handler ServerHandler) (interface{}, error)
+
+// ChainServerMiddlewares 将中间件串联起来,排在前面的中间件在最外层
+func ChainServerMiddlewares(middlewares []ServerMiddleware, handler ServerHandler) ServerHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		middleware, next := middlewares[i], handler
+		handler = func(callInfo *CallInfo, args []interface{}) (interface{}, error) {
+			return middleware(callInfo, args, next)
+		}
+	}
+	return handler
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"context"
+)
+
+type metadataKey struct{}
+
+// WithMetadata 返回携带RPC元数据的context,通过该context发起的调用会把元数据一起发送给服务端
+// 会与ctx中已有的元数据合并,相同的key以md为准
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// AppendMetadata 以key,value交替的形式添加元数据
+func AppendMetadata(ctx context.Context, kv ...string) context.Context {
+	if len(kv)%2 == 1 {
+		panic("mqrpc: AppendMetadata got an odd number of input pairs")
+	}
+	md := make(map[string]string, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return WithMetadata(ctx, md)
+}
+
+// MetadataFromContext 获取ctx中的元数据,返回的map不能修改
+func MetadataFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// Metadata 请求携带的元数据
+func (c *CallInfo) Metadata() map[string]string {
+	return c.RPCInfo.GetMetadata()
+}
+
+// GetMetadata 获取请求携带的某一项元数据
+func (c *CallInfo) GetMetadata(key string) string {
+	return c.RPCInfo.GetMetadata()[key]
+}
+
+// IdempotencyKey 幂等请求的key,服务端对设置了幂等的handler按该key去重,没有设置时按Cid去重
+const IdempotencyKey = "mqant-idempotency-key"
+
+// WithIdempotencyKey 为通过ctx发起的调用设置幂等key,重试同一个操作时使用相同的key
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return AppendMetadata(ctx, IdempotencyKey, key)
+}
@@ -25,16 +25,20 @@ type RPCInfo struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Cid      string   `protobuf:"bytes,1,opt,name=Cid,proto3" json:"Cid,omitempty"`
-	Fn       string   `protobuf:"bytes,2,opt,name=Fn,proto3" json:"Fn,omitempty"`
-	ReplyTo  string   `protobuf:"bytes,3,opt,name=ReplyTo,proto3" json:"ReplyTo,omitempty"`
-	Track    string   `protobuf:"bytes,4,opt,name=track,proto3" json:"track,omitempty"`
-	Expired  int64    `protobuf:"varint,5,opt,name=Expired,proto3" json:"Expired,omitempty"`
-	Reply    bool     `protobuf:"varint,6,opt,name=Reply,proto3" json:"Reply,omitempty"`
-	ArgsType []string `protobuf:"bytes,7,rep,name=ArgsType,proto3" json:"ArgsType,omitempty"`
-	Args     [][]byte `protobuf:"bytes,8,rep,name=Args,proto3" json:"Args,omitempty"`
-	Caller   string   `protobuf:"bytes,9,opt,name=caller,proto3" json:"caller,omitempty"`
-	Hostname string   `protobuf:"bytes,10,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Cid      string            `protobuf:"bytes,1,opt,name=Cid,proto3" json:"Cid,omitempty"`
+	Fn       string            `protobuf:"bytes,2,opt,name=Fn,proto3" json:"Fn,omitempty"`
+	ReplyTo  string            `protobuf:"bytes,3,opt,name=ReplyTo,proto3" json:"ReplyTo,omitempty"`
+	Track    string            `protobuf:"bytes,4,opt,name=track,proto3" json:"track,omitempty"`
+	Expired  int64             `protobuf:"varint,5,opt,name=Expired,proto3" json:"Expired,omitempty"`
+	Reply    bool              `protobuf:"varint,6,opt,name=Reply,proto3" json:"Reply,omitempty"`
+	ArgsType []string          `protobuf:"bytes,7,rep,name=ArgsType,proto3" json:"ArgsType,omitempty"`
+	Args     [][]byte          `protobuf:"bytes,8,rep,name=Args,proto3" json:"Args,omitempty"`
+	Caller   string            `protobuf:"bytes,9,opt,name=caller,proto3" json:"caller,omitempty"`
+	Hostname string            `protobuf:"bytes,10,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Metadata map[string]string `protobuf:"bytes,11,rep,name=Metadata,proto3" json:"Metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Stream   bool              `protobuf:"varint,12,opt,name=Stream,proto3" json:"Stream,omitempty"`
+	Window   int32             `protobuf:"varint,13,opt,name=Window,proto3" json:"Window,omitempty"`
+	Control  int32             `protobuf:"varint,14,opt,name=Control,proto3" json:"Control,omitempty"`
 }
 
 func (x *RPCInfo) Reset() {
@@ -139,21 +143,132 @@ func (x *RPCInfo) GetHostname() string {
 	return ""
 }
 
+func (x *RPCInfo) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *RPCInfo) GetStream() bool {
+	if x != nil {
+		return x.Stream
+	}
+	return false
+}
+
+func (x *RPCInfo) GetWindow() int32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *RPCInfo) GetControl() int32 {
+	if x != nil {
+		return x.Control
+	}
+	return 0
+}
+
+type RPCError struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Code      int32  `protobuf:"varint,1,opt,name=Code,proto3" json:"Code,omitempty"`
+	Message   string `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Details   string `protobuf:"bytes,3,opt,name=Details,proto3" json:"Details,omitempty"`
+	Retryable bool   `protobuf:"varint,4,opt,name=Retryable,proto3" json:"Retryable,omitempty"`
+	Node      string `protobuf:"bytes,5,opt,name=Node,proto3" json:"Node,omitempty"`
+}
+
+func (x *RPCError) Reset() {
+	*x = RPCError{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rpc_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RPCError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RPCError) ProtoMessage() {}
+
+func (x *RPCError) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RPCError.ProtoReflect.Descriptor instead.
+func (*RPCError) Descriptor() ([]byte, []int) {
+	return file_rpc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RPCError) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *RPCError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RPCError) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *RPCError) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *RPCError) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
 type ResultInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Cid        string `protobuf:"bytes,1,opt,name=Cid,proto3" json:"Cid,omitempty"`
-	Error      string `protobuf:"bytes,2,opt,name=Error,proto3" json:"Error,omitempty"`
-	ResultType string `protobuf:"bytes,4,opt,name=ResultType,proto3" json:"ResultType,omitempty"`
-	Result     []byte `protobuf:"bytes,5,opt,name=Result,proto3" json:"Result,omitempty"`
+	Cid        string    `protobuf:"bytes,1,opt,name=Cid,proto3" json:"Cid,omitempty"`
+	Error      string    `protobuf:"bytes,2,opt,name=Error,proto3" json:"Error,omitempty"`
+	ResultType string    `protobuf:"bytes,4,opt,name=ResultType,proto3" json:"ResultType,omitempty"`
+	Result     []byte    `protobuf:"bytes,5,opt,name=Result,proto3" json:"Result,omitempty"`
+	ErrorInfo  *RPCError `protobuf:"bytes,6,opt,name=ErrorInfo,proto3" json:"ErrorInfo,omitempty"`
+	Seq        int64     `protobuf:"varint,7,opt,name=Seq,proto3" json:"Seq,omitempty"`
+	EOS        bool      `protobuf:"varint,8,opt,name=EOS,proto3" json:"EOS,omitempty"`
+	Node       string    `protobuf:"bytes,9,opt,name=Node,proto3" json:"Node,omitempty"`
 }
 
 func (x *ResultInfo) Reset() {
 	*x = ResultInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_rpc_proto_msgTypes[1]
+		mi := &file_rpc_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -166,7 +281,7 @@ func (x *ResultInfo) String() string {
 func (*ResultInfo) ProtoMessage() {}
 
 func (x *ResultInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_rpc_proto_msgTypes[1]
+	mi := &file_rpc_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -179,7 +294,7 @@ func (x *ResultInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ResultInfo.ProtoReflect.Descriptor instead.
 func (*ResultInfo) Descriptor() ([]byte, []int) {
-	return file_rpc_proto_rawDescGZIP(), []int{1}
+	return file_rpc_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *ResultInfo) GetCid() string {
@@ -210,11 +325,39 @@ func (x *ResultInfo) GetResult() []byte {
 	return nil
 }
 
+func (x *ResultInfo) GetErrorInfo() *RPCError {
+	if x != nil {
+		return x.ErrorInfo
+	}
+	return nil
+}
+
+func (x *ResultInfo) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ResultInfo) GetEOS() bool {
+	if x != nil {
+		return x.EOS
+	}
+	return false
+}
+
+func (x *ResultInfo) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
 var File_rpc_proto protoreflect.FileDescriptor
 
 var file_rpc_proto_rawDesc = []byte{
 	0x0a, 0x09, 0x72, 0x70, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x05, 0x72, 0x70, 0x63,
-	0x70, 0x62, 0x22, 0xef, 0x01, 0x0a, 0x07, 0x52, 0x50, 0x43, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x10,
+	0x70, 0x62, 0x22, 0xb0, 0x03, 0x0a, 0x07, 0x52, 0x50, 0x43, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x10,
 	0x0a, 0x03, 0x43, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x43, 0x69, 0x64,
 	0x12, 0x0e, 0x0a, 0x02, 0x46, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x46, 0x6e,
 	0x12, 0x18, 0x0a, 0x07, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x54, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28,
@@ -229,14 +372,41 @@ var file_rpc_proto_rawDesc = []byte{
 	0x12, 0x16, 0x0a, 0x06, 0x63, 0x61, 0x6c, 0x6c, 0x65, 0x72, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09,
 	0x52, 0x06, 0x63, 0x61, 0x6c, 0x6c, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x68, 0x6f, 0x73, 0x74,
 	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x68, 0x6f, 0x73, 0x74,
-	0x6e, 0x61, 0x6d, 0x65, 0x22, 0x6c, 0x0a, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e,
-	0x66, 0x6f, 0x12, 0x10, 0x0a, 0x03, 0x43, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x03, 0x43, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1e, 0x0a, 0x0a, 0x52, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a,
-	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x52, 0x65, 0x73, 0x75,
-	0x6c, 0x74, 0x42, 0x1f, 0x5a, 0x1d, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x38, 0x0a, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x18, 0x0b, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x72, 0x70, 0x63, 0x70, 0x62, 0x2e, 0x52,
+	0x50, 0x43, 0x49, 0x6e, 0x66, 0x6f, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x16,
+	0x0a, 0x06, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x16, 0x0a, 0x06, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77,
+	0x18, 0x0d, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x12, 0x18,
+	0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x07, 0x43, 0x6f, 0x6e, 0x74, 0x72, 0x6f, 0x6c, 0x1a, 0x3b, 0x0a, 0x0d, 0x4d, 0x65, 0x74, 0x61,
+	0x64, 0x61, 0x74, 0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x84, 0x01, 0x0a, 0x08, 0x52, 0x50, 0x43, 0x45, 0x72, 0x72,
+	0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x18, 0x0a, 0x07, 0x44, 0x65, 0x74, 0x61, 0x69, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x44, 0x65, 0x74, 0x61, 0x69, 0x6c, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x52, 0x65,
+	0x74, 0x72, 0x79, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x52,
+	0x65, 0x74, 0x72, 0x79, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x6f, 0x64, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x22, 0xd3, 0x01, 0x0a,
+	0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x10, 0x0a, 0x03, 0x43,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x43, 0x69, 0x64, 0x12, 0x14, 0x0a,
+	0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x45, 0x72,
+	0x72, 0x6f, 0x72, 0x12, 0x1e, 0x0a, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x54, 0x79, 0x70,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x2d, 0x0a, 0x09, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f,
+	0x2e, 0x72, 0x70, 0x63, 0x70, 0x62, 0x2e, 0x52, 0x50, 0x43, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x52,
+	0x09, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x10, 0x0a, 0x03, 0x53, 0x65,
+	0x71, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x53, 0x65, 0x71, 0x12, 0x10, 0x0a, 0x03,
+	0x45, 0x4f, 0x53, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x45, 0x4f, 0x53, 0x12, 0x12,
+	0x0a, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x6f,
+	0x64, 0x65, 0x42, 0x1f, 0x5a, 0x1d, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
 	0x2f, 0x6c, 0x69, 0x61, 0x6e, 0x67, 0x64, 0x61, 0x73, 0x2f, 0x6d, 0x71, 0x61, 0x6e, 0x74, 0x2f,
 	0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
@@ -253,17 +423,21 @@ func file_rpc_proto_rawDescGZIP() []byte {
 	return file_rpc_proto_rawDescData
 }
 
-var file_rpc_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_rpc_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_rpc_proto_goTypes = []interface{}{
 	(*RPCInfo)(nil),    // 0: rpcpb.RPCInfo
-	(*ResultInfo)(nil), // 1: rpcpb.ResultInfo
+	(*RPCError)(nil),   // 1: rpcpb.RPCError
+	(*ResultInfo)(nil), // 2: rpcpb.ResultInfo
+	nil,                // 3: rpcpb.RPCInfo.MetadataEntry
 }
 var file_rpc_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	3, // 0: rpcpb.RPCInfo.Metadata:type_name -> rpcpb.RPCInfo.MetadataEntry
+	1, // 1: rpcpb.ResultInfo.ErrorInfo:type_name -> rpcpb.RPCError
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_rpc_proto_init() }
@@ -285,6 +459,18 @@ func file_rpc_proto_init() {
 			}
 		}
 		file_rpc_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RPCError); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rpc_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ResultInfo); i {
 			case 0:
 				return &v.state
@@ -303,7 +489,7 @@ func file_rpc_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_rpc_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,243 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// OverloadPolicy 协程池的排队队列已满时如何处理新的任务
+type OverloadPolicy int
+
+const (
+	// OverloadBlock 阻塞提交任务的协程(即阻塞接收新请求),直到队列有空位
+	OverloadBlock OverloadPolicy = iota
+	// OverloadReject 拒绝新的任务
+	OverloadReject
+	// OverloadShedOldest 丢弃排队最久的任务,给新的任务让位
+	OverloadShedOldest
+)
+
+func (p OverloadPolicy) String() string {
+	switch p {
+	case OverloadBlock:
+		return "block"
+	case OverloadReject:
+		return "reject"
+	case OverloadShedOldest:
+		return "shed_oldest"
+	}
+	return "unknown"
+}
+
+// ParseOverloadPolicy 解析配置文件中的策略名称 block|reject|shed_oldest
+func ParseOverloadPolicy(s string) (OverloadPolicy, error) {
+	switch s {
+	case "", "block":
+		return OverloadBlock, nil
+	case "reject":
+		return OverloadReject, nil
+	case "shed_oldest":
+		return OverloadShedOldest, nil
+	}
+	return OverloadBlock, errors.New("mqrpc: unknown overload policy " + s)
+}
+
+// DefaultPoolQueueSize 协程池默认最多排队的任务数
+var DefaultPoolQueueSize = 1024
+
+var (
+	// ErrPoolFull 协程池与排队队列都已满,任务被拒绝
+	ErrPoolFull = errors.New("mqrpc: goroutine pool overloaded")
+	// ErrPoolShed 任务排队期间被更新的任务挤出了队列
+	ErrPoolShed = errors.New("mqrpc: task shed from goroutine pool queue")
+)
+
+// PoolStats 协程池的实时计数
+type PoolStats struct {
+	Workers   int    //最大并发数
+	QueueSize int    //最多排队的任务数
+	Policy    string //排队已满时的策略
+	Executing int64  //正在执行的任务数
+	Queued    int64  //正在排队的任务数
+	Rejected  int64  //累计被拒绝的任务数
+	Shed      int64  //累计被丢弃的排队任务数
+	Completed int64  //累计执行完成的任务数
+}
+
+// Executor 可以排队执行任务的协程控制器
+// 通过RPCServer.SetGoroutineControl设置后,RegisterGO注册的handler交给它执行
+type Executor interface {
+	GoroutineControl
+	// Submit 提交任务,任务被拒绝时返回错误
+	// 已经排队的任务被丢弃时不会执行task,而是调用shed
+	Submit(task func(), shed func(err error)) error
+	Stats() PoolStats
+}
+
+type poolTask struct {
+	run  func()
+	shed func(err error)
+}
+
+/**
+Pool 有界的协程池
+最多workers个任务同时执行,其余的任务按照提交顺序排队
+执行任务的协程在队列为空时退出,空闲时不占用协程
+*/
+type Pool struct {
+	workers   int
+	queueSize int
+	policy    OverloadPolicy
+	lock      sync.Mutex
+	cond      *sync.Cond //有任务完成或者出队时通知阻塞中的提交者
+	queue     *list.List
+	executing int64
+	rejected  int64
+	shed      int64
+	completed int64
+}
+
+// NewPool 创建协程池,workers小于等于0时为1,queueSize小于0时不排队
+func NewPool(workers, queueSize int, policy OverloadPolicy) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &Pool{
+		workers:   workers,
+		queueSize: queueSize,
+		policy:    policy,
+		queue:     list.New(),
+	}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+// Submit 有空闲的名额时立即在新协程中执行,否则排队,队列已满时按照策略处理
+func (p *Pool) Submit(task func(), shed func(err error)) error {
+	p.lock.Lock()
+	for {
+		if p.executing < int64(p.workers) {
+			p.executing++
+			p.lock.Unlock()
+			go p.work(task)
+			return nil
+		}
+		if p.queue.Len() < p.queueSize {
+			p.queue.PushBack(&poolTask{run: task, shed: shed})
+			p.lock.Unlock()
+			return nil
+		}
+		switch p.policy {
+		case OverloadBlock:
+			p.cond.Wait()
+			continue
+		case OverloadShedOldest:
+			if front := p.queue.Front(); front != nil {
+				oldest := p.queue.Remove(front).(*poolTask)
+				p.queue.PushBack(&poolTask{run: task, shed: shed})
+				p.shed++
+				p.lock.Unlock()
+				if oldest.shed != nil {
+					oldest.shed(ErrPoolShed)
+				}
+				return nil
+			}
+		}
+		//没有可以丢弃的排队任务时直接拒绝
+		p.rejected++
+		p.lock.Unlock()
+		return ErrPoolFull
+	}
+}
+
+/**
+执行任务,完成后继续执行排队中的任务
+*/
+func (p *Pool) work(task func()) {
+	for task != nil {
+		p.run(task)
+		task = p.next()
+	}
+}
+
+func (p *Pool) run(task func()) {
+	defer func() {
+		p.lock.Lock()
+		p.completed++
+		p.lock.Unlock()
+	}()
+	task()
+}
+
+/**
+取出下一个排队的任务,队列为空时释放名额并返回nil
+*/
+func (p *Pool) next() func() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	defer p.cond.Broadcast()
+	if front := p.queue.Front(); front != nil {
+		return p.queue.Remove(front).(*poolTask).run
+	}
+	p.executing--
+	return nil
+}
+
+// Wait 实现GoroutineControl,占用一个名额,名额用完时按照策略阻塞或者返回ErrPoolFull
+func (p *Pool) Wait() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for p.executing >= int64(p.workers) {
+		if p.policy != OverloadBlock {
+			p.rejected++
+			return ErrPoolFull
+		}
+		p.cond.Wait()
+	}
+	p.executing++
+	return nil
+}
+
+// Finish 实现GoroutineControl,释放Wait占用的名额,有排队的任务时交给新的协程执行
+func (p *Pool) Finish() {
+	p.lock.Lock()
+	p.completed++
+	p.lock.Unlock()
+	if task := p.next(); task != nil {
+		go p.work(task)
+	}
+}
+
+// Stats 当前的计数
+func (p *Pool) Stats() PoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return PoolStats{
+		Workers:   p.workers,
+		QueueSize: p.queueSize,
+		Policy:    p.policy.String(),
+		Executing: p.executing,
+		Queued:    int64(p.queue.Len()),
+		Rejected:  p.rejected,
+		Shed:      p.shed,
+		Completed: p.completed,
+	}
+}
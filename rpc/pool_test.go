@@ -0,0 +1,104 @@
+package mqrpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOverloadPolicy(t *testing.T) {
+	for _, policy := range []OverloadPolicy{OverloadBlock, OverloadReject, OverloadShedOldest} {
+		p, err := ParseOverloadPolicy(policy.String())
+		if err != nil || p != policy {
+			t.Fatalf("Expected %v, got %v %v", policy, p, err)
+		}
+	}
+	if _, err := ParseOverloadPolicy("drop"); err == nil {
+		t.Fatal("Expected error parsing an unknown policy")
+	}
+}
+
+func TestPoolSubmit(t *testing.T) {
+	for _, policy := range []OverloadPolicy{OverloadReject, OverloadShedOldest} {
+		pool := NewPool(1, 1, policy)
+		gate := make(chan struct{})
+		ran := make(chan int, 3)
+		shed := make(chan error, 3)
+		submit := func(i int) error {
+			return pool.Submit(func() {
+				<-gate
+				ran <- i
+			}, func(err error) {
+				shed <- err
+			})
+		}
+		// 第一个任务执行,第二个任务排队,第三个任务超出队列
+		if err := submit(0); err != nil {
+			t.Fatalf("%v: unexpected error submitting: %v", policy, err)
+		}
+		if err := submit(1); err != nil {
+			t.Fatalf("%v: unexpected error submitting: %v", policy, err)
+		}
+		err := submit(2)
+		switch policy {
+		case OverloadReject:
+			if err != ErrPoolFull {
+				t.Fatalf("%v: expected ErrPoolFull, got %v", policy, err)
+			}
+		case OverloadShedOldest:
+			if err != nil {
+				t.Fatalf("%v: unexpected error submitting: %v", policy, err)
+			}
+			if err := <-shed; err != ErrPoolShed {
+				t.Fatalf("%v: expected ErrPoolShed, got %v", policy, err)
+			}
+		}
+		close(gate)
+
+		// reject执行最早的两个任务,shed_oldest丢弃排队的任务
+		expected := []int{0, 1}
+		if policy == OverloadShedOldest {
+			expected = []int{0, 2}
+		}
+		for _, want := range expected {
+			select {
+			case i := <-ran:
+				if i != want {
+					t.Fatalf("%v: expected task %d, got %d", policy, want, i)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%v: task %d did not run", policy, want)
+			}
+		}
+		for i := 0; i < 100 && pool.Stats().Executing != 0; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		stats := pool.Stats()
+		if stats.Executing != 0 || stats.Queued != 0 || stats.Completed != 2 || stats.Rejected+stats.Shed != 1 {
+			t.Fatalf("%v: unexpected pool stats %+v", policy, stats)
+		}
+	}
+}
+
+func TestPoolBlock(t *testing.T) {
+	pool := NewPool(1, 0, OverloadBlock)
+	if err := pool.Wait(); err != nil {
+		t.Fatalf("Unexpected error waiting: %v", err)
+	}
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- pool.Wait()
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("Wait should block while the pool is full, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	pool.Finish()
+	if err := <-acquired; err != nil {
+		t.Fatalf("Unexpected error waiting: %v", err)
+	}
+	pool.Finish()
+	if stats := pool.Stats(); stats.Executing != 0 || stats.Completed != 2 {
+		t.Fatalf("Unexpected pool stats %+v", stats)
+	}
+}
@@ -254,6 +254,11 @@ func Marshal(mrsp interface{}, ff func() (reply interface{}, err interface{})) e
 			return nil
 		case nil:
 			return ErrNil
+		default:
+			if reflect.TypeOf(r) == rv.Type() {
+				//登记过的类型已经被解码
+				return Assign(mrsp, r)
+			}
 		}
 	} else {
 		return fmt.Errorf("mrsp [%v] not *mqrpc.marshaler type", rv.Type())
@@ -290,6 +295,11 @@ func Proto(mrsp interface{}, ff func() (reply interface{}, err interface{})) err
 			return nil
 		case nil:
 			return ErrNil
+		default:
+			if reflect.TypeOf(r) == rv.Type() {
+				//登记过的类型已经被解码
+				return Assign(mrsp, r)
+			}
 		}
 	} else {
 		return fmt.Errorf("mrsp [%v] not *proto.Message type", rv.Type())
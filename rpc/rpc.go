@@ -19,14 +19,19 @@ import (
 	"context"
 	"github.com/liangdas/mqant/rpc/pb"
 	"reflect"
+	"time"
 )
 
 // FunctionInfo handler接口信息
 type FunctionInfo struct {
-	Function  reflect.Value
-	FuncType  reflect.Type
-	InType    []reflect.Type
-	Goroutine bool
+	Function    reflect.Value
+	FuncType    reflect.Type
+	InType      []reflect.Type
+	Goroutine   bool
+	Context     bool               //第一个参数为context.Context
+	Stream      bool               //最后一个参数为Stream
+	Middlewares []ServerMiddleware //只对该handler生效的中间件
+	Idempotent  time.Duration      //大于0时该handler是幂等的,在这段时间内重复的请求直接返回第一次的应答
 }
 
 //MQServer 代理者
@@ -40,7 +45,10 @@ type CallInfo struct {
 	Result   *rpcpb.ResultInfo
 	Props    map[string]interface{}
 	ExecTime int64
-	Agent    MQServer //代理者  AMQPServer / LocalServer 都继承 Callback(callinfo CallInfo)(error) 方法
+	Agent    MQServer        //代理者  AMQPServer / LocalServer 都继承 Callback(callinfo CallInfo)(error) 方法
+	Context  context.Context //服务端执行handler的上下文,携带剩余的超时时间与元数据
+	// IdempotencyKey 幂等handler的去重key,由服务端设置
+	IdempotencyKey string
 }
 
 // RPCListener 事件监听器
@@ -80,8 +88,15 @@ type RPCServer interface {
 	SetListener(listener RPCListener)
 	SetGoroutineControl(control GoroutineControl)
 	GetExecuting() int64
-	Register(id string, f interface{})
-	RegisterGO(id string, f interface{})
+	Use(middlewares ...ServerMiddleware)
+	Register(id string, f interface{}, middlewares ...ServerMiddleware)
+	RegisterGO(id string, f interface{}, middlewares ...ServerMiddleware)
+	// Idempotent 设置已注册的handler为幂等的,window 时间内相同Cid或者幂等key的请求只执行一次
+	Idempotent(id string, window time.Duration)
+	// Functions 已注册的handler,返回的是副本
+	Functions() map[string]*FunctionInfo
+	// Drain 下线前调用,之后的新请求以可以重试的CodeUnavailable拒绝,正在执行的请求不受影响
+	Drain()
 	Done() (err error)
 }
 
@@ -92,6 +107,16 @@ type RPCClient interface {
 	CallNRArgs(_func string, ArgsType []string, args [][]byte) (err error)
 	Call(ctx context.Context, _func string, params ...interface{}) (interface{}, string)
 	CallNR(_func string, params ...interface{}) (err error)
+	// CallArgsE 与CallArgs相同,错误以*Error返回
+	CallArgsE(ctx context.Context, _func string, ArgsType []string, args [][]byte) (interface{}, error)
+	// CallE 与Call相同,错误以*Error返回,可以通过错误码区分错误类型
+	CallE(ctx context.Context, _func string, params ...interface{}) (interface{}, error)
+	// CallInto 调用成功后将结果解码到out中,out必须是指针
+	CallInto(ctx context.Context, _func string, out interface{}, params ...interface{}) error
+	// CallAsync 异步调用,立即返回Future,通过ctx取消
+	CallAsync(ctx context.Context, _func string, params ...interface{}) *Future
+	// CallStream 流式调用,通过Stream.Recv依次读取服务端发送的消息
+	CallStream(ctx context.Context, _func string, params ...interface{}) (Stream, error)
 }
 
 // Marshaler is a simple encoding interface used for the broker/transport
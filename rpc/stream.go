@@ -0,0 +1,65 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"context"
+	"errors"
+)
+
+// 控制消息类型,通过RPCInfo.Control发送给服务端
+const (
+	// ControlNone 普通请求
+	ControlNone int32 = iota
+	// ControlAck 流式调用的调用方已经消费了RPCInfo.Window条消息,服务端可以继续发送
+	ControlAck
+	// ControlCancel 调用方已经放弃了这次请求
+	// 控制消息在接收协程中处理,不在请求队列中排队,
+	// 排在Register注册的handler之后还没有执行的请求收到取消后不再执行
+	ControlCancel
+)
+
+// DefaultStreamWindow 流式调用默认的窗口大小,服务端最多可以发送这么多条未被确认的消息
+var DefaultStreamWindow = 16
+
+var (
+	// ErrStreamClosed 流已经关闭
+	ErrStreamClosed = errors.New("mqrpc: stream closed")
+	// ErrStreamNotSupported 流只支持服务端向调用方发送消息
+	ErrStreamNotSupported = errors.New("mqrpc: server-streaming only")
+)
+
+// Request 流式调用的请求信息
+type Request interface {
+	Service() string
+	Method() string
+	ContentType() string
+	Request() interface{}
+	// indicates whether the request will be streamed
+	Stream() bool
+}
+
+// Stream represents a stream established with a client.
+// 服务端handler的最后一个参数声明为Stream即为流式handler,handler返回后流结束
+// 调用方通过RPCClient.CallStream获得Stream,Recv返回io.EOF表示流已正常结束
+// The last error will be left in Error().
+type Stream interface {
+	Context() context.Context
+	Request() Request
+	Send(interface{}) error
+	Recv(interface{}) error
+	Error() error
+	Close() error
+}
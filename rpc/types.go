@@ -0,0 +1,142 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	typesLock sync.RWMutex
+	typeNames = map[reflect.Type]string{}
+	nameTypes = map[string]reflect.Type{}
+)
+
+// RegisterType 登记消息类型,v必须是Marshaler或者proto.Message的指针
+// proto.Message使用proto.MessageName作为名称,其他类型使用 包路径.类型名
+// 登记后编码时ResultType带上该名称,调用方解码时直接得到该类型的值而不是[]byte
+func RegisterType(v interface{}) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("mqrpc: RegisterType(non-pointer %T)", v))
+	}
+	name := ""
+	if m, ok := v.(proto.Message); ok {
+		name = proto.MessageName(m)
+	}
+	if name == "" {
+		name = t.Elem().PkgPath() + "." + t.Elem().Name()
+	}
+	RegisterTypeName(name, v)
+}
+
+// RegisterTypeName 以指定的名称登记消息类型
+func RegisterTypeName(name string, v interface{}) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("mqrpc: RegisterTypeName(non-pointer %T)", v))
+	}
+	if _, ok := v.(Marshaler); !ok {
+		if _, ok := v.(proto.Message); !ok {
+			panic(fmt.Sprintf("mqrpc: RegisterTypeName(%T) is neither Marshaler nor proto.Message", v))
+		}
+	}
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	if old, ok := nameTypes[name]; ok && old != t {
+		panic(fmt.Sprintf("mqrpc: type name %s already registered by %v", name, old))
+	}
+	nameTypes[name] = t
+	typeNames[t] = name
+}
+
+// TypeName 返回v的类型登记的名称
+func TypeName(v interface{}) (string, bool) {
+	typesLock.RLock()
+	defer typesLock.RUnlock()
+	name, ok := typeNames[reflect.TypeOf(v)]
+	return name, ok
+}
+
+// NewMessage 根据登记的名称创建一个新的消息,返回的是指针
+func NewMessage(name string) (interface{}, bool) {
+	typesLock.RLock()
+	t, ok := nameTypes[name]
+	typesLock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return reflect.New(t.Elem()).Interface(), true
+}
+
+// Assign 将RPC的结果赋值给v,v必须是指针
+// value 为[]byte时按v的类型(Marshaler、proto.Message或者json)解码
+func Assign(v interface{}, value interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if b, ok := value.([]byte); ok {
+		switch dst := v.(type) {
+		case Marshaler:
+			return dst.Unmarshal(b)
+		case proto.Message:
+			return proto.Unmarshal(b, dst)
+		}
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("mqrpc: Assign(non-pointer %T)", v)
+	}
+	if value == nil {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		return nil
+	}
+	vv := reflect.ValueOf(value)
+	switch {
+	case vv.Type().AssignableTo(rv.Elem().Type()):
+		rv.Elem().Set(vv)
+		return nil
+	case vv.Type() == rv.Type():
+		//与v同类型的指针,例如登记过的消息类型
+		if vv.IsNil() {
+			rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+		} else {
+			rv.Elem().Set(vv.Elem())
+		}
+		return nil
+	case isNumber(vv.Kind()) && isNumber(rv.Elem().Kind()):
+		rv.Elem().Set(vv.Convert(rv.Elem().Type()))
+		return nil
+	}
+	if b, ok := value.([]byte); ok {
+		return json.Unmarshal(b, v)
+	}
+	return fmt.Errorf("mqrpc: cannot assign %T to %T", value, v)
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
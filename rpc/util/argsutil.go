@@ -98,6 +98,10 @@ func ArgsTypeAnd2Bytes(app module.App, arg interface{}) (string, []byte, error)
 				return ptype, vk, err
 			}
 		}
+		//没有注册的序列化器能处理时再使用内置的扩展类型
+		if ptype, vk, ok, err := encodeExtended(arg); ok {
+			return ptype, vk, err
+		}
 
 		rv := reflect.ValueOf(arg)
 		if rv.Kind() != reflect.Ptr {
@@ -113,6 +117,9 @@ func ArgsTypeAnd2Bytes(app module.App, arg interface{}) (string, []byte, error)
 				if err != nil {
 					return "", nil, fmt.Errorf("args [%s] marshal error %v", reflect.TypeOf(arg), err)
 				}
+				if name, ok := mqrpc.TypeName(arg); ok {
+					return fmt.Sprintf("%v@%v", Marshal, name), b, nil
+				}
 				if v2.String() != "" {
 					return fmt.Sprintf("%v@%v", Marshal, v2.String()), b, nil
 				} else {
@@ -125,6 +132,9 @@ func ArgsTypeAnd2Bytes(app module.App, arg interface{}) (string, []byte, error)
 					log.Error("proto.Marshal error")
 					return "", nil, fmt.Errorf("args [%s] proto.Marshal error %v", reflect.TypeOf(arg), err)
 				}
+				if name, ok := mqrpc.TypeName(arg); ok {
+					return fmt.Sprintf("%v@%v", Proto, name), b, nil
+				}
 				if v2.String() != "" {
 					return fmt.Sprintf("%v@%v", Proto, v2.String()), b, nil
 				} else {
@@ -138,10 +148,16 @@ func ArgsTypeAnd2Bytes(app module.App, arg interface{}) (string, []byte, error)
 }
 
 func Bytes2Args(app module.App, argsType string, args []byte) (interface{}, error) {
-	if strings.HasPrefix(argsType, Marshal) {
-		return args, nil
-	}
-	if strings.HasPrefix(argsType, Proto) {
+	if strings.HasPrefix(argsType, Marshal) || strings.HasPrefix(argsType, Proto) {
+		//登记过的类型直接解码,否则返回[]byte由调用方自行解码
+		if i := strings.Index(argsType, "@"); i >= 0 {
+			if v, ok := mqrpc.NewMessage(argsType[i+1:]); ok {
+				if err := mqrpc.Assign(v, args); err != nil {
+					return nil, err
+				}
+				return v, nil
+			}
+		}
 		return args, nil
 	}
 	switch argsType {
@@ -188,6 +204,9 @@ func Bytes2Args(app module.App, argsType string, args []byte) (interface{}, erro
 				return vk, err
 			}
 		}
+		if vk, ok, err := decodeExtended(argsType, args); ok {
+			return vk, err
+		}
 		return nil, fmt.Errorf("Bytes2Args [%s] not registered to app.addrpcserialize(...)", argsType)
 	}
 }
@@ -0,0 +1,101 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package argsutil
+
+import (
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/liangdas/mqant/log"
+	"github.com/liangdas/mqant/module"
+	"github.com/liangdas/mqant/rpc"
+)
+
+var (
+	marshalerType = reflect.TypeOf((*mqrpc.Marshaler)(nil)).Elem()
+	protoType     = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	//argsutil内置编码支持的类型
+	builtinTypes = map[reflect.Type]bool{
+		reflect.TypeOf(""):                       true,
+		reflect.TypeOf(false):                    true,
+		reflect.TypeOf(int32(0)):                 true,
+		reflect.TypeOf(int64(0)):                 true,
+		reflect.TypeOf(float32(0)):               true,
+		reflect.TypeOf(float64(0)):               true,
+		reflect.TypeOf([]byte{}):                 true,
+		reflect.TypeOf(map[string]interface{}{}): true,
+		reflect.TypeOf(map[string]string{}):      true,
+		reflect.TypeOf(&log.TraceSpanImp{}):      true,
+	}
+)
+
+/**
+参数类型t能否被解码
+接口类型由调用方传入的实际值决定,只能在调用时检查
+*/
+func CanDecode(app module.App, t reflect.Type) bool {
+	if t.Kind() == reflect.Interface || builtinTypes[t] {
+		return true
+	}
+	//服务端会为值类型和指针类型的参数创建对应的指针来解码
+	base := t
+	if t.Kind() == reflect.Ptr {
+		base = t.Elem()
+	}
+	ptr := reflect.PtrTo(base)
+	if ptr.Implements(marshalerType) || ptr.Implements(protoType) {
+		return true
+	}
+	return canSerialize(app, t)
+}
+
+/**
+返回值类型t能否被编码
+*/
+func CanEncode(app module.App, t reflect.Type) bool {
+	if t.Kind() == reflect.Interface || builtinTypes[t] || t == reflect.TypeOf(log.TraceSpanImp{}) {
+		return true
+	}
+	if t.Kind() == reflect.Ptr && (t.Implements(marshalerType) || t.Implements(protoType)) {
+		return true
+	}
+	return canSerialize(app, t)
+}
+
+/**
+尝试用注册到app的RPCSerialize序列化一个t类型的零值
+*/
+func canSerialize(app module.App, t reflect.Type) (ok bool) {
+	if app == nil {
+		return false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			//RPCSerialize不能处理零值
+			ok = false
+		}
+	}()
+	var v interface{}
+	if t.Kind() == reflect.Ptr {
+		v = reflect.New(t.Elem()).Interface()
+	} else {
+		v = reflect.Zero(t).Interface()
+	}
+	for _, serialize := range app.GetRPCSerialize() {
+		if _, _, err := serialize.Serialize(v); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package argsutil
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	INTN     = "intn"     //int 按int64编码
+	UINT     = "uint"     //uint
+	UINT8    = "uint8"    //uint8
+	UINT16   = "uint16"   //uint16
+	UINT32   = "uint32"   //uint32
+	UINT64   = "uint64"   //uint64
+	TIME     = "time"     //time.Time
+	DURATION = "duration" //time.Duration
+	SLICE    = "slice"    //slice@[]string 等基础类型的切片,按json编码
+)
+
+//支持的切片类型
+var sliceTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, v := range []interface{}{
+		[]string{},
+		[]bool{},
+		[]int{},
+		[]int32{},
+		[]int64{},
+		[]uint32{},
+		[]uint64{},
+		[]float32{},
+		[]float64{},
+		[]interface{}{},
+		[]map[string]interface{}{},
+	} {
+		t := reflect.TypeOf(v)
+		sliceTypes[t.String()] = t
+		builtinTypes[t] = true
+	}
+	for _, v := range []interface{}{
+		int(0), uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		time.Time{}, time.Duration(0),
+	} {
+		builtinTypes[reflect.TypeOf(v)] = true
+	}
+}
+
+func uint64ToBytes(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+func bytesToUint64(buf []byte) (uint64, error) {
+	if len(buf) != 8 {
+		return 0, fmt.Errorf("invalid length %d, expected 8", len(buf))
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+/**
+编码int、无符号整数、切片与时间类型
+ok 为false表示不是这些类型
+*/
+func encodeExtended(arg interface{}) (argsType string, b []byte, ok bool, err error) {
+	switch v := arg.(type) {
+	case int:
+		return INTN, uint64ToBytes(uint64(v)), true, nil
+	case uint:
+		return UINT, uint64ToBytes(uint64(v)), true, nil
+	case uint8:
+		return UINT8, uint64ToBytes(uint64(v)), true, nil
+	case uint16:
+		return UINT16, uint64ToBytes(uint64(v)), true, nil
+	case uint32:
+		return UINT32, uint64ToBytes(uint64(v)), true, nil
+	case uint64:
+		return UINT64, uint64ToBytes(v), true, nil
+	case time.Duration:
+		return DURATION, uint64ToBytes(uint64(v)), true, nil
+	case time.Time:
+		b, err := v.MarshalBinary()
+		return TIME, b, true, err
+	}
+	t := reflect.TypeOf(arg)
+	if st, found := sliceTypes[t.String()]; found && st == t {
+		b, err := json.Marshal(arg)
+		return SLICE + "@" + t.String(), b, true, err
+	}
+	return "", nil, false, nil
+}
+
+/**
+解码encodeExtended编码的数据
+ok 为false表示不是这些类型
+*/
+func decodeExtended(argsType string, b []byte) (v interface{}, ok bool, err error) {
+	switch argsType {
+	case INTN, UINT, UINT8, UINT16, UINT32, UINT64, DURATION:
+		u, err := bytesToUint64(b)
+		if err != nil {
+			return nil, true, fmt.Errorf("Bytes2Args [%s] %v", argsType, err)
+		}
+		switch argsType {
+		case INTN:
+			return int(u), true, nil
+		case UINT:
+			return uint(u), true, nil
+		case UINT8:
+			return uint8(u), true, nil
+		case UINT16:
+			return uint16(u), true, nil
+		case UINT32:
+			return uint32(u), true, nil
+		case DURATION:
+			return time.Duration(u), true, nil
+		}
+		return u, true, nil
+	case TIME:
+		var t time.Time
+		if err := t.UnmarshalBinary(b); err != nil {
+			return nil, true, err
+		}
+		return t, true, nil
+	}
+	if strings.HasPrefix(argsType, SLICE+"@") {
+		t, found := sliceTypes[strings.TrimPrefix(argsType, SLICE+"@")]
+		if !found {
+			return nil, true, fmt.Errorf("Bytes2Args unsupported slice type [%s]", argsType)
+		}
+		p := reflect.New(t)
+		if err := json.Unmarshal(b, p.Interface()); err != nil {
+			return nil, true, err
+		}
+		return p.Elem().Interface(), true, nil
+	}
+	return nil, false, nil
+}
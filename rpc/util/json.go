@@ -0,0 +1,120 @@
+// Copyright 2014 loolgame Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package argsutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// JSON 以json编码的结构体,类型为 json@包路径.类型名 ,指针类型为 json@*包路径.类型名
+var JSON = "json"
+
+/**
+JSONSerialize 以json编码结构体的RPCSerialize,需要通过app.AddRPCSerialize注册后才会生效
+只有通过Register登记过的结构体才会被编码,调用方与服务方都需要登记
+
+	app.AddRPCSerialize("json", argsutil.NewJSONSerialize(Player{}, Item{}))
+*/
+type JSONSerialize struct {
+	lock  sync.RWMutex
+	types map[string]reflect.Type
+}
+
+// NewJSONSerialize 创建JSONSerialize并登记values的类型
+func NewJSONSerialize(values ...interface{}) *JSONSerialize {
+	j := &JSONSerialize{
+		types: map[string]reflect.Type{},
+	}
+	j.Register(values...)
+	return j
+}
+
+// Register 登记结构体类型,值类型与指针类型都可以传递
+func (j *JSONSerialize) Register(values ...interface{}) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || t.Name() == "" {
+			panic(fmt.Sprintf("argsutil: JSONSerialize only supports named structs, got %v", reflect.TypeOf(v)))
+		}
+		j.types[JSONTypeName(t)] = t
+	}
+}
+
+// JSONTypeName 结构体的类型名 包路径.类型名
+func JSONTypeName(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
+
+func (j *JSONSerialize) Serialize(param interface{}) (ptype string, p []byte, err error) {
+	t := reflect.TypeOf(param)
+	ptr := ""
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		ptr = "*"
+	}
+	name := JSONTypeName(t)
+	j.lock.RLock()
+	_, ok := j.types[name]
+	j.lock.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("JSONSerialize [%v] not registered", reflect.TypeOf(param))
+	}
+	b, err := json.Marshal(param)
+	if err != nil {
+		return "", nil, err
+	}
+	return JSON + "@" + ptr + name, b, nil
+}
+
+func (j *JSONSerialize) Deserialize(ptype string, b []byte) (param interface{}, err error) {
+	if !strings.HasPrefix(ptype, JSON+"@") {
+		return nil, fmt.Errorf("JSONSerialize unsupported type %s", ptype)
+	}
+	name := strings.TrimPrefix(ptype, JSON+"@")
+	ptr := strings.HasPrefix(name, "*")
+	name = strings.TrimPrefix(name, "*")
+	j.lock.RLock()
+	t, ok := j.types[name]
+	j.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("JSONSerialize [%s] not registered", name)
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return nil, err
+	}
+	if ptr {
+		return v.Interface(), nil
+	}
+	return v.Elem().Interface(), nil
+}
+
+func (j *JSONSerialize) GetTypes() []string {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	types := make([]string, 0, len(j.types))
+	for name := range j.types {
+		types = append(types, JSON+"@"+name)
+	}
+	return types
+}
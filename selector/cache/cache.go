@@ -21,6 +21,9 @@ type cacheSelector struct {
 
 	watched map[string]bool
 
+	// node health
+	health *healthTracker
+
 	// used to close or reload watcher
 	reload chan bool
 	exit   chan bool
@@ -218,6 +221,7 @@ func (c *cacheSelector) update(res *registry.Result) {
 			if !seen {
 				nodes = append(nodes, cur)
 			} else {
+				c.health.remove(service.Name, cur.Id)
 				//应该删除的
 				if c.Options().Watcher != nil {
 					c.Options().Watcher(cur)
@@ -369,20 +373,43 @@ func (c *cacheSelector) Select(service string, opts ...selector.SelectOption) (s
 		services = filter(services)
 	}
 
+	// skip draining nodes
+	services = selector.FilterDraining(services)
+
+	// skip ejected nodes
+	services, probing := c.health.filter(service, services)
+
 	// if there's nothing left, return
 	if len(services) == 0 {
 		return nil, selector.ErrNoneAvailable
 	}
 
-	return sopts.Strategy(services), nil
+	next := sopts.Strategy(services)
+	if !probing {
+		return next, nil
+	}
+	// nodes past their cooldown are only probed when next picks them
+	total := 0
+	for _, s := range services {
+		total += len(s.Nodes)
+	}
+	return c.health.next(service, next, total*3), nil
 }
 
+// Mark records the result of a call against a node, nodes that fail
+// too many times in a row are ejected for a cooldown window
 func (c *cacheSelector) Mark(service string, node *registry.Node, err error) {
-	return
+	c.health.mark(service, node, err)
 }
 
+// Reset clears the health state of a service
 func (c *cacheSelector) Reset(service string) {
-	return
+	c.health.reset(service)
+}
+
+// Health returns the health state of the nodes of a service
+func (c *cacheSelector) Health(service string) []NodeHealth {
+	return c.health.health(service)
 }
 
 // Close stops the watcher and destroys the cache
@@ -419,11 +446,19 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 	}
 
 	ttl := DefaultTTL
+	threshold := DefaultFailureThreshold
+	cooldown := DefaultCooldown
 
 	if sopts.Context != nil {
 		if t, ok := sopts.Context.Value(ttlKey{}).(time.Duration); ok {
 			ttl = t
 		}
+		if n, ok := sopts.Context.Value(failureThresholdKey{}).(int); ok {
+			threshold = n
+		}
+		if t, ok := sopts.Context.Value(cooldownKey{}).(time.Duration); ok {
+			cooldown = t
+		}
 	}
 
 	return &cacheSelector{
@@ -432,6 +467,7 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 		watched: make(map[string]bool),
 		cache:   make(map[string][]*registry.Service),
 		ttls:    make(map[string]time.Time),
+		health:  newHealthTracker(threshold, cooldown),
 		reload:  make(chan bool, 1),
 		exit:    make(chan bool),
 	}
@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/liangdas/mqant/registry/mock"
 	"github.com/liangdas/mqant/selector"
@@ -27,3 +29,76 @@ func TestCacheSelector(t *testing.T) {
 
 	t.Logf("Cache Counts %v", counts)
 }
+
+func TestCacheSelectorHealth(t *testing.T) {
+	cache := NewSelector(selector.Registry(mock.NewRegistry()), FailureThreshold(2), Cooldown(50*time.Millisecond))
+	services, err := cache.GetService("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error getting service: %v", err)
+	}
+	bad := services[0].Nodes[0]
+	selectAll := func() map[string]int {
+		counts := map[string]int{}
+		next, err := cache.Select("foo")
+		if err != nil {
+			t.Fatalf("Unexpected error calling cache select: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			node, err := next()
+			if err != nil {
+				t.Fatalf("Expected node, got err: %v", err)
+			}
+			counts[node.Id]++
+		}
+		return counts
+	}
+
+	cache.Mark("foo", bad, errors.New("timeout"))
+	if counts := selectAll(); counts[bad.Id] == 0 {
+		t.Fatalf("Node should stay in rotation below the threshold: %v", counts)
+	}
+	cache.Mark("foo", bad, errors.New("timeout"))
+	if counts := selectAll(); counts[bad.Id] != 0 {
+		t.Fatalf("Ejected node was selected: %v", counts)
+	}
+	health := cache.(HealthReporter).Health("foo")
+	if len(health) != 1 || health[0].State != NodeEjected || health[0].Failures != 2 {
+		t.Fatalf("Unexpected health %+v", health)
+	}
+
+	// 冷却期过后放行一次试探,试探失败重新摘除
+	time.Sleep(60 * time.Millisecond)
+	if _, err := cache.Select("foo"); err != nil {
+		t.Fatalf("Unexpected error calling cache select: %v", err)
+	}
+	if health := cache.(HealthReporter).Health("foo"); health[0].State != NodeEjected {
+		t.Fatalf("Select without picking the node should not start a probe: %+v", health)
+	}
+	if counts := selectAll(); counts[bad.Id] != 1 {
+		t.Fatalf("Node should be probed exactly once after the cooldown: %v", counts)
+	}
+	if health := cache.(HealthReporter).Health("foo"); health[0].State != NodeHalfOpen {
+		t.Fatalf("Picked node should be half-open: %+v", health)
+	}
+	if counts := selectAll(); counts[bad.Id] != 0 {
+		t.Fatalf("Only one probe should be in flight: %v", counts)
+	}
+	cache.Mark("foo", bad, errors.New("timeout"))
+	if health := cache.(HealthReporter).Health("foo"); health[0].State != NodeEjected {
+		t.Fatalf("Failed probe should eject the node again: %+v", health)
+	}
+
+	// 试探成功后恢复
+	time.Sleep(60 * time.Millisecond)
+	selectAll()
+	cache.Mark("foo", bad, nil)
+	if health := cache.(HealthReporter).Health("foo"); health[0].State != NodeHealthy {
+		t.Fatalf("Successful probe should restore the node: %+v", health)
+	}
+
+	cache.Mark("foo", bad, errors.New("timeout"))
+	cache.Reset("foo")
+	if health := cache.(HealthReporter).Health("foo"); len(health) != 0 {
+		t.Fatalf("Reset should clear the health state: %+v", health)
+	}
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/liangdas/mqant/log"
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/selector"
+)
+
+var (
+	// DefaultFailureThreshold 节点连续失败多少次后被摘除,失败的分类见FailureThreshold
+	DefaultFailureThreshold = 5
+	// DefaultCooldown 节点被摘除后多久允许试探
+	DefaultCooldown = 10 * time.Second
+)
+
+// NodeState 节点的健康状态
+type NodeState int
+
+const (
+	// NodeHealthy 正常参与选择
+	NodeHealthy NodeState = iota
+	// NodeEjected 连续失败次数超过阈值,冷却期内不参与选择
+	NodeEjected
+	// NodeHalfOpen 冷却期已过,放行一次试探请求,成功后恢复,失败后重新摘除
+	NodeHalfOpen
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case NodeHealthy:
+		return "healthy"
+	case NodeEjected:
+		return "ejected"
+	case NodeHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// NodeHealth 节点的错误统计
+type NodeHealth struct {
+	Service             string
+	NodeID              string
+	State               NodeState
+	Successes           int64     //成功次数
+	Failures            int64     //失败次数
+	ConsecutiveFailures int       //连续失败次数
+	Ejections           int64     //被摘除的次数
+	LastError           string    //最后一次失败的错误
+	LastErrorAt         time.Time //最后一次失败的时间
+	EjectedAt           time.Time //最近一次被摘除(或者开始试探)的时间
+}
+
+// HealthReporter 可以查询节点健康状态的选择器
+type HealthReporter interface {
+	// Health 返回服务下有统计数据的节点
+	Health(service string) []NodeHealth
+}
+
+type healthTracker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	nodes     map[string]map[string]*NodeHealth
+}
+
+func newHealthTracker(threshold int, cooldown time.Duration) *healthTracker {
+	return &healthTracker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		nodes:     make(map[string]map[string]*NodeHealth),
+	}
+}
+
+func (h *healthTracker) node(service, id string) *NodeHealth {
+	nodes, ok := h.nodes[service]
+	if !ok {
+		nodes = make(map[string]*NodeHealth)
+		h.nodes[service] = nodes
+	}
+	n, ok := nodes[id]
+	if !ok {
+		n = &NodeHealth{Service: service, NodeID: id}
+		nodes[id] = n
+	}
+	return n
+}
+
+func (h *healthTracker) mark(service string, node *registry.Node, err error) {
+	if node == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	n := h.node(service, node.Id)
+	if err == nil {
+		n.Successes++
+		n.ConsecutiveFailures = 0
+		if n.State != NodeHealthy {
+			log.Info("selector node %v recovered", node.Id)
+			n.State = NodeHealthy
+		}
+		return
+	}
+	n.Failures++
+	n.ConsecutiveFailures++
+	n.LastError = err.Error()
+	n.LastErrorAt = time.Now()
+	switch n.State {
+	case NodeHalfOpen:
+		//试探失败,重新进入冷却期
+		n.State = NodeEjected
+		n.EjectedAt = time.Now()
+	case NodeHealthy:
+		if h.threshold > 0 && n.ConsecutiveFailures >= h.threshold {
+			log.Warning("selector node %v ejected after %d consecutive failures: %v", node.Id, n.ConsecutiveFailures, err)
+			n.State = NodeEjected
+			n.EjectedAt = time.Now()
+			n.Ejections++
+		}
+	}
+}
+
+/**
+过滤掉冷却期内的节点
+冷却期已过的节点保留为试探候选,由next真正选中时才转为半开状态
+所有节点都不可用时返回原来的列表,避免服务完全不可用
+*/
+func (h *healthTracker) filter(service string, services []*registry.Service) (filtered []*registry.Service, probing bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	nodes, ok := h.nodes[service]
+	if !ok {
+		return services, false
+	}
+	now := time.Now()
+	total := 0
+	for _, s := range services {
+		var keep []*registry.Node
+		for _, node := range s.Nodes {
+			n, ok := nodes[node.Id]
+			if !ok || n.State == NodeHealthy {
+				keep = append(keep, node)
+				continue
+			}
+			if h.probeable(n, now) {
+				probing = true
+				keep = append(keep, node)
+			}
+		}
+		if len(keep) > 0 {
+			total += len(keep)
+			cp := new(registry.Service)
+			*cp = *s
+			cp.Nodes = keep
+			filtered = append(filtered, cp)
+		}
+	}
+	if total == 0 {
+		return services, false
+	}
+	return filtered, probing
+}
+
+// probeable 冷却期已过,或者上一次试探超过冷却期仍没有结果
+func (h *healthTracker) probeable(n *NodeHealth, now time.Time) bool {
+	return n.State != NodeHealthy && now.Sub(n.EjectedAt) >= h.cooldown
+}
+
+/**
+包装选择策略,选中试探候选节点时才将其转为半开状态
+同一个节点同时只放行一个试探请求,已被其他请求占用的候选节点会重新选择
+*/
+func (h *healthTracker) next(service string, next selector.Next, attempts int) selector.Next {
+	return func() (*registry.Node, error) {
+		for i := 0; i < attempts; i++ {
+			node, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if h.acquire(service, node) {
+				return node, nil
+			}
+		}
+		return nil, selector.ErrNoneAvailable
+	}
+}
+
+// acquire 节点可以使用时返回true,试探候选节点在这里转为半开状态
+func (h *healthTracker) acquire(service string, node *registry.Node) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	n, ok := h.nodes[service][node.Id]
+	if !ok || n.State == NodeHealthy {
+		return true
+	}
+	now := time.Now()
+	if !h.probeable(n, now) {
+		return false
+	}
+	n.State = NodeHalfOpen
+	n.EjectedAt = now
+	return true
+}
+
+func (h *healthTracker) health(service string) []NodeHealth {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var result []NodeHealth
+	for _, n := range h.nodes[service] {
+		result = append(result, *n)
+	}
+	return result
+}
+
+func (h *healthTracker) reset(service string) {
+	h.lock.Lock()
+	delete(h.nodes, service)
+	h.lock.Unlock()
+}
+
+func (h *healthTracker) remove(service, id string) {
+	h.lock.Lock()
+	if nodes, ok := h.nodes[service]; ok {
+		delete(nodes, id)
+	}
+	h.lock.Unlock()
+}
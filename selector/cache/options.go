@@ -8,6 +8,8 @@ import (
 )
 
 type ttlKey struct{}
+type failureThresholdKey struct{}
+type cooldownKey struct{}
 
 // Set the cache ttl
 func TTL(t time.Duration) selector.Option {
@@ -18,3 +20,24 @@ func TTL(t time.Duration) selector.Option {
 		o.Context = context.WithValue(o.Context, ttlKey{}, t)
 	}
 }
+
+// FailureThreshold 节点连续失败n次后被摘除,0表示不摘除
+// App.Call只把CodeUnavailable与CodeDeadlineExceeded计为失败,业务错误视为成功,调用方主动取消的不计入
+func FailureThreshold(n int) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, failureThresholdKey{}, n)
+	}
+}
+
+// Cooldown 节点被摘除后多久允许试探
+func Cooldown(t time.Duration) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, cooldownKey{}, t)
+	}
+}
@@ -45,6 +45,9 @@ func (r *defaultSelector) Select(service string, opts ...SelectOption) (Next, er
 		services = filter(services)
 	}
 
+	// skip draining nodes
+	services = FilterDraining(services)
+
 	// if there's nothing left, return
 	if len(services) == 0 {
 		return nil, ErrNoneAvailable
@@ -70,3 +70,35 @@ func FilterVersion(version string) Filter {
 		return services
 	}
 }
+
+// FilterDraining skips the nodes that are draining before shutdown.
+// If every node is draining the services are returned unchanged,
+// draining nodes still serve requests during the grace period.
+func FilterDraining(old []*registry.Service) []*registry.Service {
+	var services []*registry.Service
+	draining := false
+
+	for _, service := range old {
+		var nodes []*registry.Node
+
+		for _, node := range service.Nodes {
+			if node.Draining() {
+				draining = true
+				continue
+			}
+			nodes = append(nodes, node)
+		}
+
+		if len(nodes) > 0 {
+			serv := new(registry.Service)
+			*serv = *service
+			serv.Nodes = nodes
+			services = append(services, serv)
+		}
+	}
+
+	if !draining || len(services) == 0 {
+		return old
+	}
+	return services
+}
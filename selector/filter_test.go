@@ -237,3 +237,37 @@ func TestFilterVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterDraining(t *testing.T) {
+	draining := map[string]string{registry.MetadataDraining: "true"}
+	services := []*registry.Service{
+		&registry.Service{
+			Name:    "test",
+			Version: "1.0.0",
+			Nodes: []*registry.Node{
+				&registry.Node{Id: "test-1", Metadata: draining},
+				&registry.Node{Id: "test-2"},
+			},
+		},
+		&registry.Service{
+			Name:    "test",
+			Version: "1.1.0",
+			Nodes: []*registry.Node{
+				&registry.Node{Id: "test-3", Metadata: draining},
+			},
+		},
+	}
+
+	filtered := FilterDraining(services)
+	if len(filtered) != 1 || len(filtered[0].Nodes) != 1 || filtered[0].Nodes[0].Id != "test-2" {
+		t.Fatalf("Expected only test-2, got %+v", filtered)
+	}
+	if len(services[0].Nodes) != 2 {
+		t.Fatal("FilterDraining should not modify the original services")
+	}
+
+	// 所有节点都在下线时仍然返回,宽限期内这些节点依然可以处理请求
+	if filtered := FilterDraining(services[1:]); len(filtered) != 1 || len(filtered[0].Nodes) != 1 {
+		t.Fatalf("Expected the draining nodes when there is no other node, got %+v", filtered)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+)
+
+// 已经注册到注册中心之后新增handler时,等待一小段时间合并多次注册
+var reregisterDelay = 100 * time.Millisecond
+
+// newEndpoints 将已注册的handler转换为注册中心的Endpoint,按名称排序
+func newEndpoints(functions map[string]*mqrpc.FunctionInfo) []*registry.Endpoint {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	endpoints := make([]*registry.Endpoint, 0, len(names))
+	for _, name := range names {
+		endpoints = append(endpoints, newEndpoint(name, functions[name]))
+	}
+	return endpoints
+}
+
+// newEndpoint 根据handler的反射信息生成Endpoint
+// Request只包含调用方需要传递的参数,context.Context与Stream由服务端传入不会出现在参数列表中
+func newEndpoint(name string, finfo *mqrpc.FunctionInfo) *registry.Endpoint {
+	request := &registry.Value{Name: name, Type: "args"}
+	in := finfo.InType
+	if finfo.Context && len(in) > 0 {
+		in = in[1:]
+	}
+	if finfo.Stream && len(in) > 0 {
+		in = in[:len(in)-1]
+	}
+	for i, t := range in {
+		request.Values = append(request.Values, newValue(fmt.Sprintf("arg%d", i), t))
+	}
+	response := &registry.Value{Name: name, Type: "result"}
+	if finfo.FuncType != nil {
+		for i := 0; i < finfo.FuncType.NumOut(); i++ {
+			outName := "result"
+			if i == 1 {
+				outName = "error"
+			}
+			response.Values = append(response.Values, newValue(outName, finfo.FuncType.Out(i)))
+		}
+	}
+	return &registry.Endpoint{
+		Name:     name,
+		Request:  request,
+		Response: response,
+		Metadata: map[string]string{
+			"goroutine": strconv.FormatBool(finfo.Goroutine),
+			"context":   strconv.FormatBool(finfo.Context),
+			"stream":    strconv.FormatBool(finfo.Stream),
+		},
+	}
+}
+
+func newValue(name string, t reflect.Type) *registry.Value {
+	return &registry.Value{
+		Name: name,
+		Type: t.String(),
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
+	"github.com/liangdas/mqant/selector"
+)
+
+func newFunctionInfo(f interface{}, goroutine bool) *mqrpc.FunctionInfo {
+	finfo := &mqrpc.FunctionInfo{
+		Function:  reflect.ValueOf(f),
+		FuncType:  reflect.TypeOf(f),
+		Goroutine: goroutine,
+	}
+	for i := 0; i < finfo.FuncType.NumIn(); i++ {
+		finfo.InType = append(finfo.InType, finfo.FuncType.In(i))
+	}
+	finfo.Context = len(finfo.InType) > 0 && finfo.InType[0] == reflect.TypeOf((*context.Context)(nil)).Elem()
+	return finfo
+}
+
+func TestEndpoints(t *testing.T) {
+	endpoints := newEndpoints(map[string]*mqrpc.FunctionInfo{
+		"login": newFunctionInfo(func(ctx context.Context, name string, level int64) (map[string]interface{}, error) {
+			return nil, nil
+		}, true),
+		"add": newFunctionInfo(func(a, b int64) (int64, string) {
+			return a + b, ""
+		}, false),
+	})
+	if len(endpoints) != 2 || endpoints[0].Name != "add" || endpoints[1].Name != "login" {
+		t.Fatalf("Endpoints should be sorted by name: %+v", endpoints)
+	}
+	login := endpoints[1]
+	if len(login.Request.Values) != 2 || login.Request.Values[0].Type != "string" || login.Request.Values[1].Type != "int64" {
+		t.Fatalf("context.Context should not be listed as an argument: %+v", login.Request.Values)
+	}
+	if len(login.Response.Values) != 2 || login.Response.Values[0].Type != "map[string]interface {}" || login.Response.Values[1].Type != "error" {
+		t.Fatalf("Unexpected response %+v", login.Response.Values)
+	}
+	if login.Metadata["goroutine"] != "true" || login.Metadata["context"] != "true" || login.Metadata["stream"] != "false" {
+		t.Fatalf("Unexpected metadata %v", login.Metadata)
+	}
+
+	services := []*registry.Service{
+		{Name: "game", Version: "1.0.0", Endpoints: endpoints},
+		{Name: "game", Version: "0.9.0"},
+	}
+	if filtered := selector.FilterEndpoint("login")(services); len(filtered) != 1 || filtered[0].Version != "1.0.0" {
+		t.Fatalf("FilterEndpoint should match the published endpoint: %+v", filtered)
+	}
+}
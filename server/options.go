@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"github.com/liangdas/mqant/registry"
+	"github.com/liangdas/mqant/rpc"
 	"time"
 )
 
@@ -18,6 +19,12 @@ type Options struct {
 
 	RegisterInterval time.Duration
 	RegisterTTL      time.Duration
+	// 下线前在注册中心标记为draining后继续处理请求的宽限期,等待调用方的选择器更新
+	DrainGrace time.Duration
+	// 对该模块所有handler生效的中间件
+	Middlewares []mqrpc.ServerMiddleware
+	// 控制handler并发数的协程控制器,为空时不限制
+	GoroutineControl mqrpc.GoroutineControl
 
 	// Other options for implementations of the interface
 	// can be stored in a context
@@ -127,6 +134,13 @@ func RegisterInterval(t time.Duration) Option {
 	}
 }
 
+// DrainGrace 下线前继续处理请求的宽限期
+func DrainGrace(t time.Duration) Option {
+	return func(o *Options) {
+		o.DrainGrace = t
+	}
+}
+
 // Wait tells the server to wait for requests to finish before exiting
 func Wait(b bool) Option {
 	return func(o *Options) {
@@ -136,3 +150,17 @@ func Wait(b bool) Option {
 		o.Context = context.WithValue(o.Context, "wait", b)
 	}
 }
+
+// Middleware 添加对该模块所有handler生效的中间件,先添加的位于外层
+func Middleware(middlewares ...mqrpc.ServerMiddleware) Option {
+	return func(o *Options) {
+		o.Middlewares = append(o.Middlewares, middlewares...)
+	}
+}
+
+// GoroutineControl 设置控制handler并发数的协程控制器,例如mqrpc.NewPool创建的协程池
+func GoroutineControl(control mqrpc.GoroutineControl) Option {
+	return func(o *Options) {
+		o.GoroutineControl = control
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type rpcServer struct {
@@ -22,6 +23,10 @@ type rpcServer struct {
 	registered bool
 	server     mqrpc.RPCServer
 	id         string
+	// re-register after new handlers are added
+	reregisterTimer *time.Timer
+	// when the node was marked as draining
+	drainStart time.Time
 	// graceful exit
 	wg sync.WaitGroup
 }
@@ -53,32 +58,81 @@ func (s *rpcServer) Init(opts ...Option) error {
 }
 
 func (s *rpcServer) OnInit(module module.Module, app module.App, settings *conf.ModuleSettings) error {
-	server, err := defaultrpc.NewRPCServer(app, module) //默认会创建一个本地的RPC
+	server, err := defaultrpc.NewRPCServerWithID(app, module, s.opts.ID) //默认会创建一个本地的RPC
 	if err != nil {
 		log.Warning("Dial: %s", err)
 	}
+	if s.opts.GoroutineControl != nil {
+		//在注册到注册中心之前设置,之后收到的请求都受控制
+		server.SetGoroutineControl(s.opts.GoroutineControl)
+	}
+	s.Lock()
 	s.server = server
+	s.Unlock()
+	s.server.Use(s.opts.Middlewares...)
 	s.opts.Address = server.Addr()
 	if err := s.ServiceRegister(); err != nil {
 		return err
 	}
 	return nil
 }
+func (s *rpcServer) GetRPCServer() mqrpc.RPCServer {
+	s.RLock()
+	defer s.RUnlock()
+	return s.server
+}
 func (s *rpcServer) SetListener(listener mqrpc.RPCListener) {
 	s.server.SetListener(listener)
 }
-func (s *rpcServer) Register(id string, f interface{}) {
+func (s *rpcServer) Use(middlewares ...mqrpc.ServerMiddleware) {
+	if s.server == nil {
+		panic("invalid RPCServer")
+	}
+	s.server.Use(middlewares...)
+}
+
+func (s *rpcServer) Register(id string, f interface{}, middlewares ...mqrpc.ServerMiddleware) {
+	if s.server == nil {
+		panic("invalid RPCServer")
+	}
+	s.server.Register(id, f, middlewares...)
+	s.reregister()
+}
+
+func (s *rpcServer) RegisterGO(id string, f interface{}, middlewares ...mqrpc.ServerMiddleware) {
 	if s.server == nil {
 		panic("invalid RPCServer")
 	}
-	s.server.Register(id, f)
+	s.server.RegisterGO(id, f, middlewares...)
+	s.reregister()
 }
 
-func (s *rpcServer) RegisterGO(id string, f interface{}) {
+func (s *rpcServer) Idempotent(id string, window time.Duration) {
 	if s.server == nil {
 		panic("invalid RPCServer")
 	}
-	s.server.RegisterGO(id, f)
+	s.server.Idempotent(id, window)
+}
+
+// reregister 已经注册到注册中心后新增的handler需要重新注册才能被发现
+func (s *rpcServer) reregister() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.registered || s.reregisterTimer != nil {
+		return
+	}
+	s.reregisterTimer = time.AfterFunc(reregisterDelay, func() {
+		s.Lock()
+		s.reregisterTimer = nil
+		registered := s.registered
+		s.Unlock()
+		if !registered {
+			return
+		}
+		if err := s.ServiceRegister(); err != nil {
+			log.Warning("RPCServer re-register fail id(%s) error(%s)", s.ID(), err)
+		}
+	})
 }
 
 func (s *rpcServer) ServiceRegister() error {
@@ -109,22 +163,33 @@ func (s *rpcServer) ServiceRegister() error {
 		return err
 	}
 
+	// Drain may update the metadata concurrently, register a copy
+	s.RLock()
+	metadata := make(map[string]string, len(config.Metadata)+2)
+	for k, v := range config.Metadata {
+		metadata[k] = v
+	}
+	s.RUnlock()
+
 	// register service
 	node := &registry.Node{
 		Id:       config.Name + "@" + config.ID,
 		Address:  addr,
 		Port:     port,
-		Metadata: config.Metadata,
+		Metadata: metadata,
 	}
+	s.Lock()
 	s.id = node.Id
+	s.Unlock()
 	node.Metadata["server"] = s.String()
 	node.Metadata["registry"] = config.Registry.String()
 
 	s.RLock()
 	// Maps are ordered randomly, sort the keys for consistency
-
 	var endpoints []*registry.Endpoint
-
+	if s.server != nil {
+		endpoints = newEndpoints(s.server.Functions())
+	}
 	s.RUnlock()
 
 	service := &registry.Service{
@@ -219,6 +284,51 @@ func (s *rpcServer) ServiceDeregister() error {
 	return nil
 }
 
+/**
+在注册中心把节点标记为draining,调用方的选择器不再选择该节点
+只标记一次,宽限期从第一次标记时开始计算
+*/
+func (s *rpcServer) MarkDraining() error {
+	s.Lock()
+	if !s.drainStart.IsZero() {
+		s.Unlock()
+		return nil
+	}
+	s.drainStart = time.Now()
+	if s.opts.Metadata == nil {
+		s.opts.Metadata = map[string]string{}
+	}
+	s.opts.Metadata[registry.MetadataDraining] = "true"
+	registered := s.registered
+	s.Unlock()
+	if registered {
+		log.Info("Draining node: %s", s.ID())
+		return s.ServiceRegister()
+	}
+	return nil
+}
+
+/**
+下线前的排空阶段
+先在注册中心把节点标记为draining,
+宽限期内继续处理请求(包括使用旧缓存的调用方发来的请求),之后新的请求以可以重试的错误拒绝
+已经通过MarkDraining标记过时只等待剩余的宽限期
+*/
+func (s *rpcServer) Drain() error {
+	err := s.MarkDraining()
+	s.RLock()
+	wait := s.opts.DrainGrace - time.Since(s.drainStart)
+	server := s.server
+	s.RUnlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	if server != nil {
+		server.Drain()
+	}
+	return err
+}
+
 func (s *rpcServer) Start() error {
 	//config := s.Options()
 
@@ -231,15 +341,22 @@ func (s *rpcServer) Start() error {
 }
 
 func (s *rpcServer) Stop() error {
-	if s.server != nil {
-		log.Info("RPCServer closeing id(%s)", s.id)
-		err := s.server.Done()
+	s.Lock()
+	if s.reregisterTimer != nil {
+		s.reregisterTimer.Stop()
+		s.reregisterTimer = nil
+	}
+	server := s.server
+	s.server = nil
+	s.Unlock()
+	if server != nil {
+		log.Info("RPCServer closeing id(%s)", s.ID())
+		err := server.Done()
 		if err != nil {
-			log.Warning("RPCServer close fail id(%s) error(%s)", s.id, err)
+			log.Warning("RPCServer close fail id(%s) error(%s)", s.ID(), err)
 		} else {
-			log.Info("RPCServer close success id(%s)", s.id)
+			log.Info("RPCServer close success id(%s)", s.ID())
 		}
-		s.server = nil
 	}
 	return nil
 }
@@ -251,10 +368,13 @@ func (s *rpcServer) OnDestroy() error {
 // Id Id
 // Deprecated: 因为命名规范问题函数将废弃,请用ID代替
 func (s *rpcServer) Id() string {
-	return s.id
+	return s.ID()
 }
 
+// ID 重新注册时会在其他协程更新
 func (s *rpcServer) ID() string {
+	s.RLock()
+	defer s.RUnlock()
 	return s.id
 }
 
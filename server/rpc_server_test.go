@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/registry/mock"
+)
+
+func TestDrain(t *testing.T) {
+	r := mock.NewRegistry()
+	s := newRPCServer(Registry(r), Name("game"), ID("1"), Advertise("127.0.0.1:0"), DrainGrace(50*time.Millisecond))
+	if err := s.ServiceRegister(); err != nil {
+		t.Fatalf("Unexpected error registering: %v", err)
+	}
+	services, err := r.GetService("game")
+	if err != nil || len(services) != 1 || len(services[0].Nodes) != 1 || services[0].Nodes[0].Draining() {
+		t.Fatalf("Unexpected registered services %+v %v", services, err)
+	}
+
+	start := time.Now()
+	if err := s.Drain(); err != nil {
+		t.Fatalf("Unexpected error draining: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Drain should wait for the grace period, returned after %v", elapsed)
+	}
+	services, _ = r.GetService("game")
+	if len(services) != 1 || len(services[0].Nodes) != 1 || !services[0].Nodes[0].Draining() {
+		t.Fatalf("The node should be marked as draining: %+v", services)
+	}
+}
+
+func TestMarkDraining(t *testing.T) {
+	r := mock.NewRegistry()
+	s := newRPCServer(Registry(r), Name("game"), ID("1"), Advertise("127.0.0.1:0"), DrainGrace(100*time.Millisecond))
+	if err := s.ServiceRegister(); err != nil {
+		t.Fatalf("Unexpected error registering: %v", err)
+	}
+	if err := s.MarkDraining(); err != nil {
+		t.Fatalf("Unexpected error marking draining: %v", err)
+	}
+	services, _ := r.GetService("game")
+	if len(services) != 1 || len(services[0].Nodes) != 1 || !services[0].Nodes[0].Draining() {
+		t.Fatalf("The node should be marked as draining: %+v", services)
+	}
+	// 宽限期从标记时开始计算,Drain只等待剩余的时间
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := s.Drain(); err != nil {
+		t.Fatalf("Unexpected error draining: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("Drain should not wait for the grace period again, took %v", elapsed)
+	}
+}
@@ -2,11 +2,11 @@
 package server
 
 import (
-	"context"
 	"github.com/liangdas/mqant/conf"
 	"github.com/liangdas/mqant/module"
 	"github.com/liangdas/mqant/rpc"
 	"github.com/pborman/uuid"
+	"time"
 )
 
 // Server Server
@@ -14,11 +14,20 @@ type Server interface {
 	Options() Options
 	OnInit(module module.Module, app module.App, settings *conf.ModuleSettings) error
 	Init(...Option) error
+	// GetRPCServer OnInit之后才可用
+	GetRPCServer() mqrpc.RPCServer
 	SetListener(listener mqrpc.RPCListener)
-	Register(id string, f interface{})
-	RegisterGO(id string, f interface{})
+	Use(middlewares ...mqrpc.ServerMiddleware)
+	Register(id string, f interface{}, middlewares ...mqrpc.ServerMiddleware)
+	RegisterGO(id string, f interface{}, middlewares ...mqrpc.ServerMiddleware)
+	// Idempotent 设置已注册的handler为幂等的,window 时间内重复的请求直接返回第一次的应答
+	Idempotent(id string, window time.Duration)
 	ServiceRegister() error
 	ServiceDeregister() error
+	// MarkDraining 在注册中心标记节点为draining,不等待宽限期
+	MarkDraining() error
+	// Drain 下线前的排空阶段,在注册中心标记节点为draining,宽限期后拒绝新的请求
+	Drain() error
 	Start() error
 	Stop() error
 	OnDestroy() error
@@ -36,27 +45,12 @@ type Message interface {
 }
 
 // Request Request
-type Request interface {
-	Service() string
-	Method() string
-	ContentType() string
-	Request() interface{}
-	// indicates whether the request will be streamed
-	Stream() bool
-}
+type Request = mqrpc.Request
 
 // Stream represents a stream established with a client.
-// A stream can be bidirectional which is indicated by the request.
-// The last error will be left in Error().
+// 由RPCServer实现,见mqrpc.Stream
 // EOF indicated end of the stream.
-type Stream interface {
-	Context() context.Context
-	Request() Request
-	Send(interface{}) error
-	Recv(interface{}) error
-	Error() error
-	Close() error
-}
+type Stream = mqrpc.Stream
 
 // Option Option
 type Option func(*Options)
@@ -108,6 +108,11 @@ func (s *service) Stop() error {
 		}
 	}
 
+	//先排空请求再从注册中心注销
+	if err := s.opts.Server.Drain(); err != nil {
+		gerr = err
+	}
+
 	if err := s.opts.Server.ServiceDeregister(); err != nil {
 		return err
 	}
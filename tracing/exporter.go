@@ -0,0 +1,71 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// JSONExporter 每个span输出为一行JSON
+type JSONExporter struct {
+	lock   sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONExporter 输出到w
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{
+		w: w,
+	}
+}
+
+// NewFileExporter 追加写入到文件,文件不存在时创建
+func NewFileExporter(path string) (*JSONExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONExporter{
+		w:      f,
+		closer: f,
+	}, nil
+}
+
+// Export 实现Exporter
+func (e *JSONExporter) Export(span *SpanData) error {
+	b, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, err = e.w.Write(b)
+	return err
+}
+
+// Close 关闭文件,NewJSONExporter创建的不会关闭w
+func (e *JSONExporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
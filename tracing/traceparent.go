@@ -0,0 +1,152 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing 分布式调用链追踪,使用W3C trace-context(traceparent)在RPC元数据中传递
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// TraceparentHeader 在RPC元数据中传递调用链的key
+const TraceparentHeader = "traceparent"
+
+// FlagSampled traceparent中的采样标记
+const FlagSampled byte = 0x01
+
+// ErrInvalidTraceparent traceparent格式不正确
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+// TraceID 调用链ID,同一条调用链上的所有span相同
+type TraceID [16]byte
+
+// SpanID span的ID
+type SpanID [8]byte
+
+// String 小写十六进制
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid 全0的ID是无效的
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// String 小写十六进制
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid 全0的ID是无效的
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext 跨进程传递的span信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+}
+
+// IsValid TraceID与SpanID都有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 编码为W3C traceparent,例如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent 解析W3C traceparent,兼容更高版本追加的字段
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return sc, ErrInvalidTraceparent
+	}
+	version, err := decodeHex(parts[0], 1)
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, ErrInvalidTraceparent
+	}
+	traceID, err := decodeHex(parts[1], len(sc.TraceID))
+	if err != nil {
+		return sc, err
+	}
+	spanID, err := decodeHex(parts[2], len(sc.SpanID))
+	if err != nil {
+		return sc, err
+	}
+	flags, err := decodeHex(parts[3], 1)
+	if err != nil {
+		return sc, err
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+/**
+只接受指定长度的小写十六进制
+*/
+func decodeHex(s string, n int) ([]byte, error) {
+	if len(s) != n*2 || strings.ToLower(s) != s {
+		return nil, ErrInvalidTraceparent
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidTraceparent
+	}
+	return b, nil
+}
+
+// Inject 把span写入元数据,sc无效时不修改
+func Inject(sc SpanContext, md map[string]string) {
+	if sc.IsValid() && md != nil {
+		md[TraceparentHeader] = sc.Traceparent()
+	}
+}
+
+// Extract 从元数据中读取调用方的span
+func Extract(md map[string]string) (SpanContext, bool) {
+	v, ok := md[TraceparentHeader]
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(v)
+	return sc, err == nil
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return
+}
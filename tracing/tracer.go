@@ -0,0 +1,210 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/liangdas/mqant/log"
+)
+
+// SpanKind span的类型
+type SpanKind int
+
+const (
+	// SpanKindInternal 进程内部的操作
+	SpanKindInternal SpanKind = iota
+	// SpanKindServer 处理收到的请求,例如RPC handler或者网关收到的消息
+	SpanKindServer
+	// SpanKindClient 发出的请求,例如RPC调用
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// SpanData 结束后导出的span
+type SpanData struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Name         string            `json:"name"`
+	Kind         string            `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Exporter 导出结束的span,需要支持并发调用
+type Exporter interface {
+	Export(span *SpanData) error
+}
+
+// Tracer 创建span,span结束后交给Exporter导出
+// nil的*Tracer可以正常使用,不会创建span
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer 创建Tracer
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+	}
+}
+
+// Start 创建span,ctx中有span或者调用方传来的span时作为父span,否则开始新的调用链
+// 返回的ctx携带新的span,用它发起的RPC调用会成为子span
+// t为nil时原样返回ctx与nil的span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:  name,
+			Kind:  kind.String(),
+			Start: time.Now(),
+		},
+	}
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Flags = parent.Flags
+		span.data.ParentSpanID = parent.SpanID.String()
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Flags = FlagSampled
+	}
+	span.sc.SpanID = newSpanID()
+	span.data.TraceID = span.sc.TraceID.String()
+	span.data.SpanID = span.sc.SpanID.String()
+	return ContextWithSpan(ctx, span), span
+}
+
+// Span 一次操作,nil的*Span可以正常使用
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	lock   sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext 用于传递给其他进程
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute 设置属性,结束后的修改无效
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]string{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError 记录操作失败,err为nil时不修改
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	if !s.ended {
+		s.data.Error = err.Error()
+	}
+	s.lock.Unlock()
+}
+
+// End 结束并导出,只有第一次调用生效
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.lock.Unlock()
+	if s.tracer.exporter != nil {
+		if err := s.tracer.exporter.Export(&data); err != nil {
+			log.Warning("tracing export span %s error %v", data.Name, err)
+		}
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// ContextWithSpan 在ctx中携带span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 获取ctx中的span,没有时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpan 在ctx中携带调用方传来的span,用于创建子span
+func ContextWithRemoteSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext 获取ctx中的span信息,本进程的span优先
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing traceparent: %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || sc.Flags != FlagSampled {
+		t.Fatalf("Unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != header {
+		t.Fatalf("Expected %s, got %s", header, sc.Traceparent())
+	}
+	// 更高版本可以追加字段
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Fatalf("Future versions should be accepted: %v", err)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Fatalf("Expected %q to be rejected", invalid)
+		}
+	}
+
+	md := map[string]string{}
+	Inject(sc, md)
+	if extracted, ok := Extract(md); !ok || extracted != sc {
+		t.Fatalf("Expected to extract %+v, got %+v", sc, extracted)
+	}
+	if _, ok := Extract(map[string]string{TraceparentHeader: "invalid"}); ok {
+		t.Fatal("Invalid traceparent should not be extracted")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewJSONExporter(&buf))
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := tracer.Start(ContextWithRemoteSpan(context.Background(), remote), "gate", SpanKindServer)
+	_, child := tracer.Start(ctx, "login", SpanKindClient)
+	child.SetAttribute("rpc.method", "login")
+	child.SetError(errors.New("not found"))
+	child.End()
+	child.End()
+	parent.End()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 exported spans, got %q", buf.String())
+	}
+	var spans [2]SpanData
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &spans[i]); err != nil {
+			t.Fatalf("Unexpected error decoding %s: %v", line, err)
+		}
+	}
+	c, p := spans[0], spans[1]
+	if p.TraceID != remote.TraceID.String() || p.ParentSpanID != remote.SpanID.String() || p.Kind != "server" {
+		t.Fatalf("The parent should continue the remote trace: %+v", p)
+	}
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID || c.Kind != "client" {
+		t.Fatalf("Unexpected child span %+v", c)
+	}
+	if c.Attributes["rpc.method"] != "login" || c.Error != "not found" || c.End.Before(c.Start) {
+		t.Fatalf("Unexpected child span data %+v", c)
+	}
+
+	// 没有父span时开始新的调用链,nil的Tracer不创建span
+	_, root := tracer.Start(context.Background(), "root", SpanKindInternal)
+	if !root.SpanContext().IsValid() || root.SpanContext().TraceID == remote.TraceID {
+		t.Fatalf("Expected a new trace, got %+v", root.SpanContext())
+	}
+	var none *Tracer
+	if ctx, span := none.Start(ctx, "none", SpanKindInternal); span != nil || SpanFromContext(ctx) != parent {
+		t.Fatal("A nil tracer should not create spans")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memory 进程内的消息通道实现,无需启动nats即可运行完整的多模块应用,主要用于单元测试
+package memory
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liangdas/mqant/transport"
+)
+
+// DefaultPendingLimit 单个订阅最多可以堆积的消息数量,超过后新消息会被丢弃
+var DefaultPendingLimit = 65536
+
+type memoryTransport struct {
+	sync.RWMutex
+	subs map[string]map[*subscription]bool
+	next uint64 //队列组轮流投递的计数
+	seq  uint64 //订阅的序号,队列组按照订阅顺序轮流投递
+}
+
+// NewTransport 创建一个进程内的消息通道
+func NewTransport() transport.Transport {
+	return &memoryTransport{
+		subs: make(map[string]map[*subscription]bool),
+	}
+}
+
+func (m *memoryTransport) Publish(subject string, data []byte) error {
+	m.RLock()
+	defer m.RUnlock()
+	var err error
+	var queues map[string][]*subscription
+	for sub := range m.subs[subject] {
+		if sub.queue != "" {
+			if queues == nil {
+				queues = map[string][]*subscription{}
+			}
+			queues[sub.queue] = append(queues[sub.queue], sub)
+			continue
+		}
+		if e := sub.deliver(subject, data); e != nil {
+			err = e
+		}
+	}
+	for _, members := range queues {
+		//每个队列组轮流选择一个订阅者
+		sort.Slice(members, func(i, j int) bool { return members[i].seq < members[j].seq })
+		sub := members[int(atomic.AddUint64(&m.next, 1)%uint64(len(members)))]
+		if e := sub.deliver(subject, data); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (m *memoryTransport) SubscribeSync(subject string) (transport.Subscription, error) {
+	return m.subscribe(subject, "")
+}
+
+func (m *memoryTransport) QueueSubscribeSync(subject, queue string) (transport.Subscription, error) {
+	return m.subscribe(subject, queue)
+}
+
+func (m *memoryTransport) subscribe(subject, queue string) (transport.Subscription, error) {
+	sub := &subscription{
+		subject:   subject,
+		queue:     queue,
+		transport: m,
+		msgs:      make(chan *transport.Message, DefaultPendingLimit),
+		closed:    make(chan bool),
+	}
+	m.Lock()
+	m.seq++
+	sub.seq = m.seq
+	if _, ok := m.subs[subject]; !ok {
+		m.subs[subject] = make(map[*subscription]bool)
+	}
+	m.subs[subject][sub] = true
+	m.Unlock()
+	return sub, nil
+}
+
+func (m *memoryTransport) NewInbox() string {
+	return transport.NewInbox()
+}
+
+func (m *memoryTransport) String() string {
+	return "memory"
+}
+
+func (m *memoryTransport) unsubscribe(sub *subscription) {
+	m.Lock()
+	defer m.Unlock()
+	if subs, ok := m.subs[sub.subject]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(m.subs, sub.subject)
+		}
+	}
+}
+
+type subscription struct {
+	subject   string
+	queue     string
+	seq       uint64
+	transport *memoryTransport
+	msgs      chan *transport.Message
+	closed    chan bool
+	once      sync.Once
+}
+
+func (s *subscription) deliver(subject string, data []byte) error {
+	// 拷贝一份数据,与经过网络传输时一样发送方与接收方不共享内存
+	b := make([]byte, len(data))
+	copy(b, data)
+	msg := &transport.Message{
+		Subject: subject,
+		Data:    b,
+	}
+	select {
+	case s.msgs <- msg:
+		return nil
+	default:
+		return transport.ErrSlowConsumer
+	}
+}
+
+func (s *subscription) NextMsg(timeout time.Duration) (*transport.Message, error) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case msg := <-s.msgs:
+		return msg, nil
+	case <-s.closed:
+		return nil, transport.ErrBadSubscription
+	case <-t.C:
+		return nil, transport.ErrTimeout
+	}
+}
+
+func (s *subscription) IsValid() bool {
+	select {
+	case <-s.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *subscription) Unsubscribe() error {
+	s.once.Do(func() {
+		s.transport.unsubscribe(s)
+		close(s.closed)
+	})
+	return nil
+}
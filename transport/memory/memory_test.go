@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/transport"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	tr := NewTransport()
+
+	inbox := tr.NewInbox()
+	sub1, err := tr.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+	sub2, err := tr.SubscribeSync(inbox)
+	if err != nil {
+		t.Fatalf("Unexpected error subscribing: %v", err)
+	}
+
+	data := []byte("hello")
+	if err := tr.Publish(inbox, data); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	data[0] = 'j'
+
+	for _, sub := range []transport.Subscription{sub1, sub2} {
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error reading message: %v", err)
+		}
+		if string(msg.Data) != "hello" {
+			t.Fatalf("Expected %q, got %q", "hello", msg.Data)
+		}
+		if msg.Subject != inbox {
+			t.Fatalf("Expected subject %s, got %s", inbox, msg.Subject)
+		}
+	}
+
+	if _, err := sub1.NextMsg(time.Millisecond * 10); err != transport.ErrTimeout {
+		t.Fatalf("Expected %v, got %v", transport.ErrTimeout, err)
+	}
+
+	sub1.Unsubscribe()
+	if sub1.IsValid() {
+		t.Fatal("Expected subscription to be invalid after unsubscribe")
+	}
+	if _, err := sub1.NextMsg(time.Second); err != transport.ErrBadSubscription {
+		t.Fatalf("Expected %v, got %v", transport.ErrBadSubscription, err)
+	}
+
+	tr.Publish(inbox, []byte("world"))
+	msg, err := sub2.NextMsg(time.Second)
+	if err != nil || string(msg.Data) != "world" {
+		t.Fatalf("Expected world, got %v %v", msg, err)
+	}
+}
+
+func TestMemoryTransportSlowConsumer(t *testing.T) {
+	limit := DefaultPendingLimit
+	DefaultPendingLimit = 1
+	defer func() { DefaultPendingLimit = limit }()
+
+	tr := NewTransport()
+	sub, _ := tr.SubscribeSync("foo")
+	if err := tr.Publish("foo", []byte("1")); err != nil {
+		t.Fatalf("Unexpected error publishing: %v", err)
+	}
+	if err := tr.Publish("foo", []byte("2")); err != transport.ErrSlowConsumer {
+		t.Fatalf("Expected %v, got %v", transport.ErrSlowConsumer, err)
+	}
+	msg, _ := sub.NextMsg(time.Second)
+	if string(msg.Data) != "1" {
+		t.Fatalf("Expected 1, got %s", msg.Data)
+	}
+}
+
+func TestMemoryTransportQueue(t *testing.T) {
+	tr := NewTransport()
+	plain, _ := tr.SubscribeSync("mqant.test")
+	q1, _ := tr.QueueSubscribeSync("mqant.test", "mqant.test")
+	q2, _ := tr.QueueSubscribeSync("mqant.test", "mqant.test")
+
+	for i := 0; i < 4; i++ {
+		if err := tr.Publish("mqant.test", []byte("hello")); err != nil {
+			t.Fatalf("Unexpected error publishing: %v", err)
+		}
+	}
+	count := func(sub transport.Subscription) int {
+		n := 0
+		for {
+			if _, err := sub.NextMsg(time.Millisecond * 10); err != nil {
+				return n
+			}
+			n++
+		}
+	}
+	if n := count(plain); n != 4 {
+		t.Fatalf("Expected the plain subscriber to receive every message, got %d", n)
+	}
+	// 队列组内每条消息只投递一次,轮流分配给订阅者
+	n1, n2 := count(q1), count(q2)
+	if n1 != 2 || n2 != 2 {
+		t.Fatalf("Expected the queue group to split 4 messages evenly, got %d and %d", n1, n2)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	if s := transport.ModuleSubject("gate"); s != "mqant.gate" {
+		t.Fatalf("Expected mqant.gate, got %s", s)
+	}
+	if s := transport.NodeSubject("gate", "a.b*c"); s != "mqant.gate.a_b_c" {
+		t.Fatalf("Expected mqant.gate.a_b_c, got %s", s)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsTransport struct {
+	conn func() *nats.Conn //当前的连接,app管理的连接重建后返回新的连接
+}
+
+// NewNatsTransport 基于nats连接创建消息通道
+func NewNatsTransport(nc *nats.Conn) Transport {
+	return &natsTransport{
+		conn: func() *nats.Conn { return nc },
+	}
+}
+
+func (t *natsTransport) Publish(subject string, data []byte) error {
+	return t.conn().Publish(subject, data)
+}
+
+func (t *natsTransport) SubscribeSync(subject string) (Subscription, error) {
+	subs, err := t.conn().SubscribeSync(subject)
+	if err != nil {
+		return nil, err
+	}
+	return &natsSubscription{subs: subs}, nil
+}
+
+func (t *natsTransport) QueueSubscribeSync(subject, queue string) (Subscription, error) {
+	subs, err := t.conn().QueueSubscribeSync(subject, queue)
+	if err != nil {
+		return nil, err
+	}
+	return &natsSubscription{subs: subs}, nil
+}
+
+func (t *natsTransport) NewInbox() string {
+	return nats.NewInbox()
+}
+
+func (t *natsTransport) String() string {
+	return "nats"
+}
+
+type natsSubscription struct {
+	subs *nats.Subscription
+}
+
+func (s *natsSubscription) NextMsg(timeout time.Duration) (*Message, error) {
+	m, err := s.subs.NextMsg(timeout)
+	if err != nil {
+		switch err {
+		case nats.ErrTimeout:
+			return nil, ErrTimeout
+		case nats.ErrBadSubscription, nats.ErrConnectionClosed:
+			return nil, ErrBadSubscription
+		case nats.ErrSlowConsumer:
+			return nil, ErrSlowConsumer
+		}
+		return nil, err
+	}
+	return &Message{
+		Subject: m.Subject,
+		Data:    m.Data,
+	}, nil
+}
+
+func (s *natsSubscription) IsValid() bool {
+	return s.subs.IsValid()
+}
+
+func (s *natsSubscription) Unsubscribe() error {
+	return s.subs.Unsubscribe()
+}
@@ -0,0 +1,308 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liangdas/mqant/conf"
+	"github.com/liangdas/mqant/log"
+	"github.com/nats-io/nats.go"
+)
+
+// ConnState nats连接的状态
+type ConnState int32
+
+const (
+	// StateConnected 已连接
+	StateConnected ConnState = iota
+	// StateReconnecting 连接断开,nats客户端正在重连
+	StateReconnecting
+	// StateRedialing 超过最大重连次数连接已关闭,正在重新建立连接
+	StateRedialing
+	// StateClosed 已调用Close
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateRedialing:
+		return "redialing"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ErrNoServers 配置中没有nats服务器地址
+var ErrNoServers = errors.New("transport: no nats servers configured")
+
+// NatsStats nats连接的实时状态
+type NatsStats struct {
+	State      string //连接状态
+	URL        string //当前连接的服务器
+	Reconnects int64  //累计重连成功的次数,包括重新建立连接
+	LastError  string //最近一次连接错误
+}
+
+/**
+NatsConn 由配置创建并管理的nats连接
+断开后由nats客户端自动重连,重连期间订阅保持有效,恢复后继续接收消息;
+超过最大重连次数连接关闭后重新建立连接,RPC的订阅在失效后通过Transport重新订阅到新的连接
+*/
+type NatsConn struct {
+	cfg        conf.Nats
+	url        string
+	opts       []nats.Option
+	lock       sync.RWMutex
+	conn       *nats.Conn
+	state      ConnState
+	reconnects int64
+	lastErr    error
+	done       chan struct{}
+}
+
+// DialNats 按照配置建立nats连接
+func DialNats(cfg conf.Nats) (*NatsConn, error) {
+	if len(cfg.Servers) == 0 {
+		return nil, ErrNoServers
+	}
+	c := &NatsConn{
+		cfg:  cfg,
+		url:  strings.Join(cfg.Servers, ","),
+		done: make(chan struct{}),
+	}
+	opts, err := NatsOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.opts = append(opts,
+		nats.DisconnectHandler(c.onDisconnect),
+		nats.ReconnectHandler(c.onReconnect),
+		nats.ClosedHandler(c.onClosed),
+		nats.ErrorHandler(c.onError),
+	)
+	nc, err := nats.Connect(c.url, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = nc
+	log.Info("nats connected to %s", nc.ConnectedUrl())
+	return c, nil
+}
+
+// NatsOptions 把配置转换为nats连接参数,不包括状态回调
+func NatsOptions(cfg conf.Nats) ([]nats.Option, error) {
+	var opts []nats.Option
+	if cfg.Name != "" {
+		opts = append(opts, nats.Name(cfg.Name))
+	}
+	if cfg.User != "" {
+		opts = append(opts, nats.UserInfo(cfg.User, cfg.Password))
+	}
+	if cfg.Token != "" {
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+	if cfg.Credentials != "" {
+		opts = append(opts, nats.UserCredentials(cfg.Credentials))
+	}
+	if cfg.TLS.CA != "" || cfg.TLS.Cert != "" || cfg.TLS.InsecureSkipVerify {
+		//Secure需要在RootCAs与ClientCert之前设置,否则会覆盖它们加载的证书
+		opts = append(opts, nats.Secure(&tls.Config{
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		}))
+		if cfg.TLS.CA != "" {
+			opts = append(opts, nats.RootCAs(cfg.TLS.CA))
+		}
+		if cfg.TLS.Cert != "" {
+			if cfg.TLS.Key == "" {
+				return nil, errors.New("transport: nats TLS Cert requires Key")
+			}
+			opts = append(opts, nats.ClientCert(cfg.TLS.Cert, cfg.TLS.Key))
+		}
+	}
+	if cfg.MaxReconnects != 0 {
+		opts = append(opts, nats.MaxReconnects(cfg.MaxReconnects))
+	}
+	if cfg.ReconnectWait > 0 {
+		opts = append(opts, nats.ReconnectWait(time.Duration(cfg.ReconnectWait)*time.Millisecond))
+	}
+	if cfg.PingInterval > 0 {
+		opts = append(opts, nats.PingInterval(time.Duration(cfg.PingInterval)*time.Millisecond))
+	}
+	if cfg.MaxPingsOut > 0 {
+		opts = append(opts, nats.MaxPingsOutstanding(cfg.MaxPingsOut))
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts = append(opts, nats.Timeout(time.Duration(cfg.ConnectTimeout)*time.Millisecond))
+	}
+	return opts, nil
+}
+
+// Conn 当前的连接,重新建立连接后返回新的连接
+func (c *NatsConn) Conn() *nats.Conn {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.conn
+}
+
+// Transport 使用该连接的消息通道,重新建立连接后自动使用新的连接
+func (c *NatsConn) Transport() Transport {
+	return &natsTransport{
+		conn: c.Conn,
+	}
+}
+
+// State 连接状态
+func (c *NatsConn) State() ConnState {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.state
+}
+
+// Stats 连接的实时状态
+func (c *NatsConn) Stats() NatsStats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	stats := NatsStats{
+		State:      c.state.String(),
+		Reconnects: c.reconnects,
+	}
+	if c.conn != nil {
+		stats.URL = c.conn.ConnectedUrl()
+	}
+	if c.lastErr != nil {
+		stats.LastError = c.lastErr.Error()
+	}
+	return stats
+}
+
+// Close 关闭连接,之后不再重连
+func (c *NatsConn) Close() {
+	c.lock.Lock()
+	select {
+	case <-c.done:
+		c.lock.Unlock()
+		return
+	default:
+	}
+	close(c.done)
+	c.state = StateClosed
+	nc := c.conn
+	c.lock.Unlock()
+	nc.Close()
+}
+
+/**
+回调可能来自已经被替换的旧连接,只处理当前连接的事件
+*/
+func (c *NatsConn) update(nc *nats.Conn, f func()) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn != nc || c.state == StateClosed {
+		return false
+	}
+	f()
+	return true
+}
+
+func (c *NatsConn) onDisconnect(nc *nats.Conn) {
+	err := nc.LastError()
+	if c.update(nc, func() {
+		c.state = StateReconnecting
+		if err != nil {
+			c.lastErr = err
+		}
+	}) {
+		log.Warning("nats disconnected error(%v), reconnecting", err)
+	}
+}
+
+func (c *NatsConn) onReconnect(nc *nats.Conn) {
+	if c.update(nc, func() {
+		c.state = StateConnected
+		c.reconnects++
+	}) {
+		log.Info("nats reconnected to %s", nc.ConnectedUrl())
+	}
+}
+
+func (c *NatsConn) onClosed(nc *nats.Conn) {
+	if c.update(nc, func() {
+		c.state = StateRedialing
+	}) {
+		log.Error("nats connection closed error(%v), redialing", nc.LastError())
+		go c.redial()
+	}
+}
+
+func (c *NatsConn) onError(nc *nats.Conn, sub *nats.Subscription, err error) {
+	c.update(nc, func() {
+		c.lastErr = err
+	})
+	if sub != nil {
+		log.Error("nats subscription %s error(%v)", sub.Subject, err)
+	} else {
+		log.Error("nats error(%v)", err)
+	}
+}
+
+func (c *NatsConn) reconnectWait() time.Duration {
+	if c.cfg.ReconnectWait > 0 {
+		return time.Duration(c.cfg.ReconnectWait) * time.Millisecond
+	}
+	return nats.DefaultReconnectWait
+}
+
+/**
+重新建立连接,直到成功或者调用Close
+*/
+func (c *NatsConn) redial() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.reconnectWait()):
+		}
+		nc, err := nats.Connect(c.url, c.opts...)
+		if err != nil {
+			c.lock.Lock()
+			c.lastErr = err
+			c.lock.Unlock()
+			log.Warning("nats redial error(%v)", err)
+			continue
+		}
+		c.lock.Lock()
+		if c.state == StateClosed {
+			c.lock.Unlock()
+			nc.Close()
+			return
+		}
+		c.conn = nc
+		c.state = StateConnected
+		c.reconnects++
+		c.lock.Unlock()
+		log.Info("nats redialed to %s", nc.ConnectedUrl())
+		return
+	}
+}
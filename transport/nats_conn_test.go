@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liangdas/mqant/conf"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNatsOptions(t *testing.T) {
+	opts, err := NatsOptions(conf.Nats{
+		Name:           "mqant",
+		User:           "user",
+		Password:       "secret",
+		TLS:            conf.NatsTLS{InsecureSkipVerify: true},
+		MaxReconnects:  -1,
+		ReconnectWait:  500,
+		PingInterval:   10000,
+		MaxPingsOut:    3,
+		ConnectTimeout: 1500,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error building options: %v", err)
+	}
+	o := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			t.Fatalf("Unexpected error applying option: %v", err)
+		}
+	}
+	if o.Name != "mqant" || o.User != "user" || o.Password != "secret" {
+		t.Fatalf("Expected the name and credentials to be set, got %+v", o)
+	}
+	if !o.Secure || o.TLSConfig == nil || !o.TLSConfig.InsecureSkipVerify {
+		t.Fatal("Expected TLS to be enabled without verification")
+	}
+	if o.MaxReconnect != -1 || o.ReconnectWait != 500*time.Millisecond {
+		t.Fatalf("Expected the reconnect policy to be set, got %v %v", o.MaxReconnect, o.ReconnectWait)
+	}
+	if o.PingInterval != 10*time.Second || o.MaxPingsOut != 3 || o.Timeout != 1500*time.Millisecond {
+		t.Fatalf("Expected ping and timeout settings to be set, got %v %v %v", o.PingInterval, o.MaxPingsOut, o.Timeout)
+	}
+
+	if _, err := NatsOptions(conf.Nats{TLS: conf.NatsTLS{Cert: "client.pem"}}); err == nil {
+		t.Fatal("Expected an error when the TLS key is missing")
+	}
+}
+
+func TestDialNats(t *testing.T) {
+	if _, err := DialNats(conf.Nats{}); err != ErrNoServers {
+		t.Fatalf("Expected %v, got %v", ErrNoServers, err)
+	}
+	if _, err := DialNats(conf.Nats{Servers: []string{"nats://127.0.0.1:1"}, ConnectTimeout: 100}); err == nil {
+		t.Fatal("Expected an error dialing an unreachable server")
+	}
+}
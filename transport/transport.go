@@ -0,0 +1,86 @@
+// Copyright 2014 mqant Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transport RPC消息通道定义
+package transport
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/liangdas/mqant/utils/uuid"
+)
+
+// Transport RPC客户端与服务端之间的消息通道
+// 默认实现基于nats, transport/memory 提供了一个进程内的实现
+type Transport interface {
+	// Publish 向指定地址发送一条消息
+	Publish(subject string, data []byte) error
+	// SubscribeSync 订阅指定地址,通过Subscription.NextMsg读取消息
+	SubscribeSync(subject string) (Subscription, error)
+	// QueueSubscribeSync 以队列组方式订阅,同一队列组的订阅者中只有一个会收到消息
+	QueueSubscribeSync(subject, queue string) (Subscription, error)
+	// NewInbox 创建一个唯一的收件地址,用于接收请求或者应答
+	NewInbox() string
+	String() string
+}
+
+// Subscription 同步订阅
+type Subscription interface {
+	// NextMsg 读取下一条消息,超时返回ErrTimeout
+	NextMsg(timeout time.Duration) (*Message, error)
+	// IsValid 订阅是否仍然有效
+	IsValid() bool
+	Unsubscribe() error
+}
+
+// Message 通道中传输的消息
+type Message struct {
+	Subject string
+	Data    []byte
+}
+
+var (
+	// ErrTimeout 读取消息超时
+	ErrTimeout = errors.New("transport: timeout")
+	// ErrBadSubscription 订阅已失效
+	ErrBadSubscription = errors.New("transport: invalid subscription")
+	// ErrSlowConsumer 订阅方消息堆积过多,消息被丢弃
+	ErrSlowConsumer = errors.New("transport: slow consumer, messages dropped")
+)
+
+// InboxPrefix 收件地址前缀
+const InboxPrefix = "_INBOX."
+
+// NewInbox 创建一个唯一的收件地址
+func NewInbox() string {
+	return InboxPrefix + uuid.Rand().Hex()
+}
+
+// SubjectPrefix 开启队列组时模块地址的前缀
+const SubjectPrefix = "mqant"
+
+var subjectEscaper = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+// ModuleSubject 模块所有节点以队列组方式共同订阅的地址 mqant.<type>
+func ModuleSubject(moduleType string) string {
+	return SubjectPrefix + "." + subjectEscaper.Replace(moduleType)
+}
+
+// NodeSubject 单个节点的地址 mqant.<type>.<id>
+// 类型与ID中nats地址不允许的字符替换为 _
+func NodeSubject(moduleType, id string) string {
+	return ModuleSubject(moduleType) + "." + subjectEscaper.Replace(id)
+}